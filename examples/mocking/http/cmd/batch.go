@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Output formats selected with the -format flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// errRequestsFailed is returned by a batch, or an interactive session, with at least one failed request.
+var errRequestsFailed = errors.New("requests failed")
+
+// errNotRegular reports a path given on the command line which is neither a regular file nor a directory.
+var errNotRegular = errors.New("not a regular file or directory")
+
+// input is a single payload of a batch.
+type input struct {
+	// source names the payload in the output, a file path or a line number.
+	source string
+	data   []byte
+	// err is set when the payload could not be read, so it is reported without sending a request.
+	err error
+}
+
+// result is the outcome of a single request of a batch.
+type result struct {
+	Source string `json:"source"`
+	Size   int    `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// fileInputs yields the content of every regular file in paths, walking directories recursively in lexical order.
+// Symlinks in paths are followed. Inside a walked directory only symlinks to regular files are, symlinks to
+// directories are skipped so the walk cannot loop. A path in paths which is not a regular file or a directory,
+// such as a device or a dangling symlink, is yielded with an error, so it counts as a failure.
+func fileInputs(paths []string) iter.Seq[input] {
+	return func(yield func(input) bool) {
+		stopped := false
+		// emit yields in and stops the walk once the consumer is done.
+		emit := func(in input) error {
+			if !yield(in) {
+				stopped = true
+				return fs.SkipAll
+			}
+			return nil
+		}
+		for _, root := range paths {
+			info, err := os.Stat(root)
+			switch {
+			case err != nil:
+				emit(input{source: root, err: err})
+			case info.Mode().IsRegular():
+				emit(readInput(root))
+			case info.IsDir():
+				walkInputs(root, emit)
+			default:
+				emit(input{source: root, err: fmt.Errorf("%w: %s", errNotRegular, info.Mode().Type())})
+			}
+			if stopped {
+				return
+			}
+		}
+	}
+}
+
+// walkInputs passes the regular files in the directory root to emit.
+func walkInputs(root string, emit func(input) error) {
+	walkRoot := root
+	if info, err := os.Lstat(root); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		// WalkDir does not follow a symlinked root, unless a trailing separator makes Lstat resolve it.
+		walkRoot += string(filepath.Separator)
+	}
+	filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Reporting the unreadable entry and carrying on with the rest.
+			return emit(input{source: path, err: err})
+		}
+		switch {
+		case d.Type().IsRegular():
+		case d.Type()&fs.ModeSymlink != 0:
+			info, err := os.Stat(path)
+			if err != nil {
+				return emit(input{source: path, err: err})
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+		default:
+			return nil
+		}
+		return emit(readInput(path))
+	})
+}
+
+// readInput reads the file at path.
+func readInput(path string) input {
+	data, err := os.ReadFile(path)
+	return input{source: path, data: data, err: err}
+}
+
+// lineInputs yields every non-empty line read from lines, named by its line number, until ctx is done.
+func lineInputs(ctx context.Context, lines <-chan []byte) iter.Seq[input] {
+	return func(yield func(input) bool) {
+		n := 0
+		for {
+			var (
+				line []byte
+				ok   bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok = <-lines:
+			}
+			if !ok {
+				return
+			}
+			n++
+			if len(line) == 0 {
+				continue
+			}
+			if !yield(input{source: "line " + strconv.Itoa(n), data: line}) {
+				return
+			}
+		}
+	}
+}
+
+// writeResults writes results to out in format.
+func writeResults(out io.Writer, format string, results []result) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if results == nil {
+			// An empty batch is an empty list rather than null.
+			results = []result{}
+		}
+		return encoder.Encode(results)
+	case formatCSV:
+		w := csv.NewWriter(out)
+		w.Write([]string{"source", "size", "error"})
+		for _, r := range results {
+			w.Write([]string{r.Source, strconv.Itoa(r.Size), r.Error})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE\tSIZE\tERROR")
+		for _, r := range results {
+			size := strconv.Itoa(r.Size)
+			if r.Error != "" {
+				size = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Source, size, r.Error)
+		}
+		return w.Flush()
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mocking_http/internal/client"
+	"mocking_http/internal/server"
+)
+
+// writeFiles creates files with the given contents, relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"b.txt":       "bb",
+		"a/2.txt":     "22",
+		"a/1.txt":     "1",
+		"a/nested/x":  "xxx",
+		"single.data": "single",
+	})
+
+	var got []string
+	for in := range fileInputs([]string{filepath.Join(dir, "single.data"), filepath.Join(dir, "a"), filepath.Join(dir, "missing"), filepath.Join(dir, "b.txt")}) {
+		rel, _ := filepath.Rel(dir, in.source)
+		if in.err != nil {
+			got = append(got, rel+"=error")
+			continue
+		}
+		got = append(got, rel+"="+string(in.data))
+	}
+
+	// Directories are walked in lexical order, a missing path is reported in place.
+	want := []string{"single.data=single", "a/1.txt=1", "a/2.txt=22", "a/nested/x=xxx", "missing=error", "b.txt=bb"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	t.Run("symlinks", func(t *testing.T) {
+		links := t.TempDir()
+		for name, target := range map[string]string{
+			"file":          filepath.Join(dir, "single.data"),
+			"dir":           filepath.Join(dir, "a"),
+			"dangling":      filepath.Join(dir, "missing"),
+			"a/nested/file": filepath.Join(dir, "b.txt"),
+			"a/nested/loop": filepath.Join(links, "a"),
+		} {
+			os.MkdirAll(filepath.Join(links, filepath.Dir(name)), 0o755)
+			if err := os.Symlink(target, filepath.Join(links, name)); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+		}
+
+		var got []string
+		for in := range fileInputs([]string{filepath.Join(links, "file"), filepath.Join(links, "dir"), filepath.Join(links, "dangling"), filepath.Join(links, "a")}) {
+			rel, _ := filepath.Rel(links, in.source)
+			if in.err != nil {
+				got = append(got, rel+"=error")
+				continue
+			}
+			got = append(got, rel+"="+string(in.data))
+		}
+
+		// Symlinked paths are followed, inside a walked directory only those to files are.
+		want := []string{"file=single", "dir/1.txt=1", "dir/2.txt=22", "dir/nested/x=xxx", "dangling=error", "a/nested/file=bb"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+	t.Run("not_regular", func(t *testing.T) {
+		if _, err := os.Stat(os.DevNull); err != nil {
+			t.Skip(err)
+		}
+		var got []input
+		for in := range fileInputs([]string{os.DevNull}) {
+			got = append(got, in)
+		}
+		if len(got) != 1 || !errors.Is(got[0].err, errNotRegular) {
+			t.Fatalf("expected a single %v input, got %+v", errNotRegular, got)
+		}
+	})
+	t.Run("stop", func(t *testing.T) {
+		var got int
+		for range fileInputs([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b.txt")}) {
+			got++
+			break
+		}
+		if got != 1 {
+			t.Fatalf("expected the walk to stop after 1 input, got %d", got)
+		}
+	})
+}
+
+func TestLineInputs(t *testing.T) {
+	lines, readErr := readLines(t.Context(), strings.NewReader("a\n\nbc\n"))
+
+	var got []string
+	for in := range lineInputs(t.Context(), lines) {
+		got = append(got, in.source+"="+string(in.data))
+	}
+	if want := "line 1=a,line 3=bc"; strings.Join(got, ",") != want {
+		t.Fatalf("expected %s, got %v", want, got)
+	}
+	if err := <-readErr; err != nil {
+		t.Fatalf("expected no read error, got `%v`", err)
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	results := []result{
+		{Source: "a.txt", Size: 3},
+		{Source: "dir/b, c.txt", Error: "unexpected status code: 413"},
+	}
+	cases := map[string]struct {
+		format  string
+		results []result
+		want    string
+	}{
+		"table": {
+			format:  formatTable,
+			results: results,
+			want: "SOURCE        SIZE  ERROR\n" +
+				"a.txt         3     \n" +
+				"dir/b, c.txt  -     unexpected status code: 413\n",
+		},
+		"json": {
+			format:  formatJSON,
+			results: results,
+			want: `[
+  {
+    "source": "a.txt",
+    "size": 3
+  },
+  {
+    "source": "dir/b, c.txt",
+    "size": 0,
+    "error": "unexpected status code: 413"
+  }
+]
+`,
+		},
+		"json_empty": {format: formatJSON, want: "[]\n"},
+		"csv": {
+			format:  formatCSV,
+			results: results,
+			want:    "source,size,error\na.txt,3,\n\"dir/b, c.txt\",0,unexpected status code: 413\n",
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeResults(&out, tt.format, tt.results); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	srv := httptest.NewServer(&server.Server{MaxBodySize: 4})
+	defer srv.Close()
+	c := client.NewClient(srv.URL, nil)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"ok.txt": "1234", "large.txt": "12345"})
+
+	t.Run("ok", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runBatch(t.Context(), c, fileInputs([]string{filepath.Join(dir, "ok.txt")}), formatCSV, &out)
+		if err != nil {
+			t.Fatalf("expected no error, got `%v`", err)
+		}
+		if want := "source,size,error\n" + filepath.Join(dir, "ok.txt") + ",4,\n"; out.String() != want {
+			t.Fatalf("expected %q, got %q", want, out.String())
+		}
+	})
+	t.Run("failed", func(t *testing.T) {
+		// Every input is sent even after a failure.
+		var out bytes.Buffer
+		err := runBatch(t.Context(), c, fileInputs([]string{dir, filepath.Join(dir, "missing")}), formatCSV, &out)
+		if !errors.Is(err, errRequestsFailed) || !strings.Contains(err.Error(), "2 of 3") {
+			t.Fatalf("expected 2 of 3 failed requests, got `%v`", err)
+		}
+		if got := strings.Count(out.String(), "\n"); got != 4 {
+			t.Fatalf("expected header and 3 results, got %q", out.String())
+		}
+		if !strings.Contains(out.String(), "413") {
+			t.Fatalf("expected the status error of large.txt, got %q", out.String())
+		}
+	})
+	t.Run("symlink", func(t *testing.T) {
+		// A symlinked file argument is sent, a dangling one fails the batch.
+		link, dangling := filepath.Join(t.TempDir(), "link"), filepath.Join(t.TempDir(), "dangling")
+		if err := os.Symlink(filepath.Join(dir, "ok.txt"), link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		os.Symlink(filepath.Join(dir, "missing"), dangling)
+
+		var out bytes.Buffer
+		err := runBatch(t.Context(), c, fileInputs([]string{link, dangling}), formatCSV, &out)
+		if !errors.Is(err, errRequestsFailed) || !strings.Contains(err.Error(), "1 of 2") {
+			t.Fatalf("expected 1 of 2 failed requests, got `%v`", err)
+		}
+		if !strings.Contains(out.String(), link+",4,\n") {
+			t.Fatalf("expected the size of the linked file, got %q", out.String())
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		var out bytes.Buffer
+		err := runBatch(ctx, c, fileInputs([]string{dir}), formatCSV, &out)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected cancelled batch, got `%v`", err)
+		}
+		if out.String() != "source,size,error\n" {
+			t.Fatalf("expected no results, got %q", out.String())
+		}
+	})
+}
+
+func TestRunInteractive(t *testing.T) {
+	srv := httptest.NewServer(&server.Server{})
+	defer srv.Close()
+	c := client.NewClient(srv.URL, nil)
+
+	cases := map[string]struct {
+		input string
+		want  string
+	}{
+		"empty_line": {input: "123\nhello world\n\nignored\n", want: "> client | size  | 3\n> client | size  | 11\n> "},
+		"end":        {input: "1234\n", want: "> client | size  | 4\n> \n"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			lines, readErr := readLines(t.Context(), strings.NewReader(tt.input))
+			if err := runInteractive(t.Context(), c, lines, readErr, &out); err != nil {
+				t.Fatalf("expected no error, got `%v`", err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+	t.Run("failed", func(t *testing.T) {
+		// The session goes on after a failure, which is reported at the end.
+		limited := httptest.NewServer(&server.Server{MaxBodySize: 4})
+		defer limited.Close()
+
+		var out bytes.Buffer
+		lines, readErr := readLines(t.Context(), strings.NewReader("12345\n123\n"))
+		err := runInteractive(t.Context(), client.NewClient(limited.URL, nil), lines, readErr, &out)
+		if !errors.Is(err, errRequestsFailed) || !strings.Contains(err.Error(), "1 of 2") {
+			t.Fatalf("expected 1 of 2 failed requests, got `%v`", err)
+		}
+		if !strings.Contains(out.String(), "client | size  | 3") {
+			t.Fatalf("expected the second line to be sent, got %q", out.String())
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		reader, writer := io.Pipe()
+		defer writer.Close()
+
+		lines, readErr := readLines(ctx, reader)
+		cancel()
+		if err := runInteractive(ctx, c, lines, readErr, io.Discard); err != nil {
+			t.Fatalf("expected no error, got `%v`", err)
+		}
+	})
+}
+
+func TestRun_Files(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "abc", "b/c.txt": "hello"})
+
+	var stdout bytes.Buffer
+	err := waitResult(t, runAsync(t.Context(), []string{"-addr", "127.0.0.1:0", "-format", "json", dir}, nil, &stdout))
+	if err != nil {
+		t.Fatalf("expected no error, got `%v`", err)
+	}
+	if !strings.Contains(stdout.String(), `"size": 3`) || !strings.Contains(stdout.String(), `"size": 5`) {
+		t.Fatalf("expected sizes of both files, got %q", stdout.String())
+	}
+}
@@ -2,90 +2,333 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"iter"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"mocking_http/internal/client"
 	"mocking_http/internal/server"
 )
 
-func runServer(addr string, exitCh <-chan struct{}) {
+// Modes of operation selected with the -mode flag.
+const (
+	modeServer = "server"
+	modeClient = "client"
+	modeBoth   = "both"
+)
+
+type config struct {
+	addr            string
+	target          string
+	mode            string
+	format          string
+	requestTimeout  time.Duration
+	shutdownTimeout time.Duration
+	// files lists the files and directories sent by the client instead of the input lines.
+	files []string
+}
+
+// parseFlags parses the command line arguments, reporting usage errors to output.
+func parseFlags(args []string, output io.Writer) (config, error) {
+	var cfg config
+
+	flags := flag.NewFlagSet("mocking_http", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&cfg.addr, "addr", ":8080", "listen address of the server")
+	flags.StringVar(&cfg.target, "target", "", "URL of the server used by the client, defaults to the listen address")
+	flags.StringVar(&cfg.mode, "mode", modeBoth, "what to run: server, client or both")
+	flags.StringVar(&cfg.format, "format", formatTable, "output format of a batch: table, json or csv")
+	flags.DurationVar(&cfg.requestTimeout, "request-timeout", 30*time.Second, "maximum time spent on a single request")
+	flags.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 5*time.Second, "maximum time to wait for in-flight requests on shutdown")
+	flags.Usage = func() {
+		fmt.Fprintln(output, "Usage: mocking_http [flags] [file or directory...]")
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, "The client sends every given file, or every line of a piped input, and prints the results.")
+		fmt.Fprintln(output, "On a terminal it prompts for lines until an empty one.")
+		fmt.Fprintln(output)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return config{}, err
+	}
+	cfg.files = flags.Args()
+
+	switch cfg.mode {
+	case modeServer, modeClient, modeBoth:
+	default:
+		return config{}, fmt.Errorf("unknown mode %q, want server, client or both", cfg.mode)
+	}
+	switch cfg.format {
+	case formatTable, formatJSON, formatCSV:
+	default:
+		return config{}, fmt.Errorf("unknown format %q, want table, json or csv", cfg.format)
+	}
+	if cfg.target == "" && cfg.mode == modeClient {
+		cfg.target = targetURL(cfg.addr)
+	}
+	return cfg, nil
+}
+
+// targetURL returns the URL of a server listening on addr.
+func targetURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// run runs the program until ctx is cancelled or, when the client runs, until its input ends.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cfg, err := parseFlags(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	if cfg.mode == modeClient {
+		return runClient(ctx, cfg, stdin, stdout)
+	}
+
+	listener, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("server listening", slog.String("addr", listener.Addr().String()))
+
+	if cfg.mode == modeServer {
+		return runServer(ctx, listener, cfg)
+	}
+
+	if cfg.target == "" {
+		// The actual address, in case the port was chosen by the system.
+		cfg.target = targetURL(listener.Addr().String())
+	}
+
+	// The server is stopped once the client is done.
+	serverCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var (
+		wg        sync.WaitGroup
+		serverErr error
+	)
+	wg.Go(func() {
+		serverErr = runServer(serverCtx, listener, cfg)
+	})
+	clientErr := runClient(ctx, cfg, stdin, stdout)
+	stop()
+	wg.Wait()
+
+	return errors.Join(clientErr, serverErr)
+}
+
+// runServer serves on listener until ctx is cancelled and then shuts down,
+// waiting at most cfg.shutdownTimeout for in-flight requests.
+func runServer(ctx context.Context, listener net.Listener, cfg config) error {
+	// The request ID is set first so the access log and everything below can refer to it.
+	// Recover sits inside Logging, so recovered panics are logged as 500.
+	handler := server.Chain(&server.Server{},
+		server.RequestID,
+		server.Logging(slog.Default()),
+		server.Recover(slog.Default()),
+		server.Timeout(cfg.requestTimeout),
+	)
 	srv := http.Server{
-		Addr:    addr,
-		Handler: &server.Server{},
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.requestTimeout,
 	}
 
 	// Running server in a separate routine
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Bounding shutdown, so a stuck connection cannot block the process forever.
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Dropping the connections which did not finish in time.
+		srv.Close()
+		return fmt.Errorf("server shutdown: %w", err)
+	}
+	return nil
+}
+
+// runClient sends the files of cfg, or the lines read from in, to the server at cfg.target.
+// A terminal input is read interactively, anything else is processed as a batch.
+func runClient(ctx context.Context, cfg config, in io.Reader, out io.Writer) error {
+	// Not http.DefaultClient, which would wait for a stalled server forever.
+	c := client.NewClient(cfg.target, &http.Client{Timeout: cfg.requestTimeout})
+
+	if len(cfg.files) > 0 {
+		return runBatch(ctx, c, fileInputs(cfg.files), cfg.format, out)
+	}
+
+	lines, readErr := readLines(ctx, in)
+	if isTerminal(in) {
+		return runInteractive(ctx, c, lines, readErr, out)
+	}
+	if err := runBatch(ctx, c, lineInputs(ctx, lines), cfg.format, out); err != nil {
+		return err
+	}
+	return readInputError(<-readErr)
+}
+
+// readLines reads lines from in in a separate routine, since a read from stdin cannot be interrupted by ctx.
+// The lines channel is closed at the end of in or when ctx is done, after the read error is sent.
+func readLines(ctx context.Context, in io.Reader) (<-chan []byte, <-chan error) {
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				slog.Error("server closed with err", slog.String("error", err.Error()))
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			// The scanner reuses its buffer, so the line is copied before handing it over.
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				readErr <- nil
+				return
 			}
 		}
+		readErr <- scanner.Err()
 	}()
+	return lines, readErr
+}
 
-	// Handling graceful shutdown in function routine to block until all connections are closed
-	// In proper code it should receive a context with deadline to avoid blocking indefinitely, but here
-	// there is no processing so that isn't an issue.
-	<-exitCh
-	if err := srv.Shutdown(context.Background()); err != nil {
-		slog.Error("server shutdown with err", slog.String("error", err.Error()))
+func readInputError(err error) error {
+	if err != nil {
+		return fmt.Errorf("client: reading input: %w", err)
 	}
+	return nil
 }
 
-func runClient(serverAddr string, exitCh chan<- struct{}) {
-	client := client.NewClient(serverAddr, nil)
+// isTerminal reports whether in is a terminal rather than a pipe or a file.
+func isTerminal(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
+// runInteractive prompts for lines and prints their sizes to out.
+// It returns when the input ends, an empty line is read or ctx is cancelled. Failed requests are printed as
+// they happen and, like in a batch, make it return errRequestsFailed at the end, so scripts driving
+// a terminal see them in the exit status.
+func runInteractive(ctx context.Context, c *client.Client, lines <-chan []byte, readErr <-chan error, out io.Writer) error {
+	var sent, failed int
+	// done reports the failed requests, unless err is more important.
+	done := func(err error) error {
+		if err == nil && failed > 0 {
+			err = fmt.Errorf("%w: %d of %d", errRequestsFailed, failed, sent)
+		}
+		return err
+	}
 
-	fmt.Print("> ")
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	fmt.Fprint(out, "> ")
+	for {
+		var (
+			line []byte
+			ok   bool
+		)
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return done(nil)
+		case line, ok = <-lines:
+		}
+		if !ok {
+			fmt.Fprintln(out)
+			return done(readInputError(<-readErr))
+		}
 		if len(line) == 0 {
-			break
+			return done(nil)
 		}
 
-		size, err := client.GetSize(line)
+		sent++
+		size, err := c.GetSizeContext(ctx, line)
 		if err != nil {
+			failed++
 			slog.Error("client get size", slog.String("error", err.Error()))
-			fmt.Printf("client | error | %s\n", err.Error())
+			fmt.Fprintf(out, "client | error | %s\n", err.Error())
 		} else {
-			fmt.Printf("client | size  | %d\n", size)
+			fmt.Fprintf(out, "client | size  | %d\n", size)
 		}
 
-		fmt.Print("> ")
+		fmt.Fprint(out, "> ")
 	}
-	if err := scanner.Err(); err != nil {
-		slog.Error("client: reading stdin", slog.String("error", err.Error()))
-	}
-	close(exitCh)
 }
 
-func main() {
+// runBatch sends every input and writes the results to out in format.
+// It fails with errRequestsFailed when any input could not be read or sent.
+// A cancelled ctx stops the batch, the results collected so far are still written.
+func runBatch(ctx context.Context, c *client.Client, inputs iter.Seq[input], format string, out io.Writer) error {
 	var (
-		wG sync.WaitGroup
-
-		exitCh = make(chan struct{})
-		port   = 8080
+		results []result
+		failed  int
 	)
+	for in := range inputs {
+		if ctx.Err() != nil {
+			break
+		}
+		r := result{Source: in.source}
+		err := in.err
+		if err == nil {
+			r.Size, err = c.GetSizeContext(ctx, in.data)
+		}
+		if err != nil {
+			slog.Error("client get size", slog.String("source", in.source), slog.String("error", err.Error()))
+			r.Error = err.Error()
+			failed++
+		}
+		results = append(results, r)
+	}
 
-	wG.Add(2)
-
-	go func() {
-		runServer(fmt.Sprintf(":%d", port), exitCh)
-		wG.Done()
-	}()
+	if err := writeResults(out, format, results); err != nil {
+		return fmt.Errorf("client: writing results: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("client: batch interrupted: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", errRequestsFailed, failed, len(results))
+	}
+	return nil
+}
 
-	go func() {
-		runClient(fmt.Sprintf("http://localhost:%d", port), exitCh)
-		wG.Done()
-	}()
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Waiting for both server and client to close gracefully
-	wG.Wait()
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		slog.Error("exiting with err", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 }
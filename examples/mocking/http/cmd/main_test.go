@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mocking_http/internal/client"
+	"mocking_http/internal/server"
+)
+
+// freeAddr returns a local address with a port nobody listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// runAsync starts run in a separate routine and returns the channel receiving its result.
+func runAsync(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, args, stdin, stdout, io.Discard)
+	}()
+	return done
+}
+
+// waitResult waits for the result of run, failing the test when it does not return in time.
+func waitResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return")
+		return nil
+	}
+}
+
+// waitServer polls the server at addr until it responds.
+func waitServer(t *testing.T, addr string) {
+	t.Helper()
+	c := client.NewClient("http://"+addr, nil)
+	for range 100 {
+		if _, err := c.GetSize(nil); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server at %s did not start", addr)
+}
+
+func TestRun_Both(t *testing.T) {
+	var stdout bytes.Buffer
+	// A piped input is processed as a batch, skipping empty lines.
+	stdin := strings.NewReader("123\nhello world\n\nlast\n")
+
+	err := waitResult(t, runAsync(t.Context(), []string{"-addr", "127.0.0.1:0", "-format", "csv"}, stdin, &stdout))
+	if err != nil {
+		t.Fatalf("expected no error, got `%v`", err)
+	}
+
+	want := "source,size,error\nline 1,3,\nline 2,11,\nline 4,4,\n"
+	if stdout.String() != want {
+		t.Fatalf("expected output %q, got %q", want, stdout.String())
+	}
+}
+
+func TestRun_Client(t *testing.T) {
+	srv := httptest.NewServer(&server.Server{})
+	defer srv.Close()
+
+	var stdout bytes.Buffer
+	stdin := strings.NewReader("1234\n")
+
+	err := waitResult(t, runAsync(t.Context(), []string{"-mode", "client", "-target", srv.URL}, stdin, &stdout))
+	if err != nil {
+		t.Fatalf("expected no error, got `%v`", err)
+	}
+
+	want := "SOURCE  SIZE  ERROR\nline 1  4     \n"
+	if stdout.String() != want {
+		t.Fatalf("expected output %q, got %q", want, stdout.String())
+	}
+}
+
+func TestRun_ClientError(t *testing.T) {
+	var stdout bytes.Buffer
+	stdin := strings.NewReader("1234\n")
+
+	// Nobody listens at the target, the failure is reported and fails the run.
+	err := waitResult(t, runAsync(t.Context(), []string{"-mode", "client", "-target", "http://" + freeAddr(t)}, stdin, &stdout))
+	if !errors.Is(err, errRequestsFailed) {
+		t.Fatalf("expected failed requests, got `%v`", err)
+	}
+	if !strings.Contains(stdout.String(), "connection refused") {
+		t.Fatalf("expected error output, got %q", stdout.String())
+	}
+}
+
+func TestRun_ClientTimeout(t *testing.T) {
+	// The server never responds, the request gives up after -request-timeout.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	var stdout bytes.Buffer
+	stdin := strings.NewReader("1234\n")
+
+	args := []string{"-mode", "client", "-target", srv.URL, "-request-timeout", "100ms"}
+	err := waitResult(t, runAsync(t.Context(), args, stdin, &stdout))
+	if !errors.Is(err, errRequestsFailed) {
+		t.Fatalf("expected failed requests, got `%v`", err)
+	}
+	if !strings.Contains(stdout.String(), "Client.Timeout exceeded") {
+		t.Fatalf("expected timeout output, got %q", stdout.String())
+	}
+}
+
+func TestRun_Server(t *testing.T) {
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	done := runAsync(ctx, []string{"-mode", "server", "-addr", addr}, nil, io.Discard)
+	waitServer(t, addr)
+
+	// The middlewares are wired in.
+	response, err := http.Post("http://"+addr, "text/plain", strings.NewReader("123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.Header.Get(server.RequestIDHeader) == "" {
+		t.Errorf("expected %s header", server.RequestIDHeader)
+	}
+
+	// Cancelling the context stands in for SIGINT/SIGTERM.
+	cancel()
+	if err := waitResult(t, done); err != nil {
+		t.Fatalf("expected clean shutdown, got `%v`", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("expected the server to stop listening")
+	}
+}
+
+func TestRun_Signal(t *testing.T) {
+	// A client waiting for input is stopped by the signal as well.
+	// The batch is incomplete, so the run fails.
+	ctx, cancel := context.WithCancel(t.Context())
+	stdin, writer := io.Pipe()
+	defer writer.Close()
+
+	done := runAsync(ctx, []string{"-addr", "127.0.0.1:0"}, stdin, io.Discard)
+	cancel()
+
+	if err := waitResult(t, done); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected interrupted batch, got `%v`", err)
+	}
+}
+
+func TestRun_ShutdownDeadline(t *testing.T) {
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	done := runAsync(ctx, []string{"-mode", "server", "-addr", addr, "-shutdown-timeout", "100ms"}, nil, io.Discard)
+	waitServer(t, addr)
+
+	// A request stuck sending its body keeps the server busy.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 10\r\n\r\n123"); err != nil {
+		t.Fatal(err)
+	}
+	// Giving the server a moment to start reading the body.
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	start := time.Now()
+	err = waitResult(t, done)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected shutdown deadline exceeded, got `%v`", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected shutdown bounded by the deadline, took %v", elapsed)
+	}
+	// The stuck connection is dropped.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("expected the connection to be closed, got `%v`", err)
+	}
+}
+
+func TestRun_Flags(t *testing.T) {
+	cases := map[string]struct {
+		args    []string
+		wantErr string
+	}{
+		"unknown_mode":   {args: []string{"-mode", "proxy"}, wantErr: `unknown mode "proxy"`},
+		"unknown_flag":   {args: []string{"-port", "8080"}, wantErr: "flag provided but not defined"},
+		"unknown_format": {args: []string{"-format", "xml"}, wantErr: `unknown format "xml"`},
+		"bad_duration":   {args: []string{"-shutdown-timeout", "soon"}, wantErr: "invalid value"},
+		"bad_addr":       {args: []string{"-mode", "server", "-addr", "127.0.0.1:-1"}, wantErr: "listen"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := run(t.Context(), tt.args, nil, io.Discard, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got `%v`", tt.wantErr, err)
+			}
+		})
+	}
+	t.Run("help", func(t *testing.T) {
+		var stderr bytes.Buffer
+		err := run(t.Context(), []string{"-h"}, nil, io.Discard, &stderr)
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Fatalf("expected flag.ErrHelp, got `%v`", err)
+		}
+		if !strings.Contains(stderr.String(), "-shutdown-timeout") {
+			t.Fatalf("expected usage, got %q", stderr.String())
+		}
+	})
+}
+
+func TestTargetURL(t *testing.T) {
+	cases := map[string]string{
+		":8080":          "http://localhost:8080",
+		"0.0.0.0:8080":   "http://localhost:8080",
+		"[::]:8080":      "http://localhost:8080",
+		"127.0.0.1:9000": "http://127.0.0.1:9000",
+		"[::1]:9000":     "http://[::1]:9000",
+		"example.com":    "http://example.com",
+	}
+	for addr, want := range cases {
+		t.Run(addr, func(t *testing.T) {
+			if got := targetURL(addr); got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
@@ -2,3 +2,7 @@ module mocking_http
 
 go 1.25
 
+require (
+	github.com/jonboulle/clockwork v0.5.0
+	github.com/klauspost/compress v1.18.0
+)
@@ -0,0 +1,286 @@
+// Package cassette records real HTTP interactions into testdata files and replays them in tests,
+// so client tests do not need to set up a server each time.
+//
+// Bodies are stored as text, which is enough for the size server and keeps cassettes readable.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// ErrNoInteraction is returned by Replayer when no recorded interaction matches a request.
+var ErrNoInteraction = errors.New("cassette: no matching interaction")
+
+// Doer is the interface of http.Client used by the recorder and replayer.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Match selects the request attributes compared when replaying. Values can be combined with `|`.
+type Match int
+
+const (
+	MatchMethod Match = 1 << iota
+	// MatchURL compares the URL path and query. The host is ignored, as test servers listen on random ports.
+	MatchURL
+	// MatchBody compares the SHA-256 hash of the request body.
+	MatchBody
+
+	MatchAll = MatchMethod | MatchURL | MatchBody
+)
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// BodyHash is the hex encoded SHA-256 of the body, so large payloads do not bloat the cassette.
+	BodyHash string `json:"body_hash"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("cassette: decoding %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating the parent directories if needed.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder is a Doer passing requests to a real Doer and recording every interaction.
+type Recorder struct {
+	next Doer
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a Recorder which saves its cassette to path when the test finishes.
+func NewRecorder(t testing.TB, path string, next Doer) *Recorder {
+	r := &Recorder{next: next}
+	t.Cleanup(func() {
+		if err := r.Cassette().Save(path); err != nil {
+			t.Errorf("saving cassette: %v", err)
+		}
+	})
+	return r
+}
+
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := r.next.Do(req)
+	if err != nil {
+		// Transport errors cannot be replayed, so they are not recorded.
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: newRequest(req, body),
+		Response: Response{
+			StatusCode: response.StatusCode,
+			Header:     response.Header,
+			Body:       string(respBody),
+		},
+	})
+	return response, nil
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Replayer is a Doer serving recorded responses. Every interaction is served at most once,
+// in the order it was recorded.
+type Replayer struct {
+	t     testing.TB
+	match Match
+	// strict fails the test on unmatched requests and on interactions left unused.
+	strict bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// ReplayerOption configures a Replayer.
+type ReplayerOption func(*Replayer)
+
+// WithMatch sets the request attributes compared when looking up an interaction. Defaults to MatchAll.
+func WithMatch(match Match) ReplayerOption {
+	return func(r *Replayer) {
+		r.match = match
+	}
+}
+
+// Strict makes the replayer fail the test on any unmatched request and on interactions
+// which were not used by the end of the test.
+func Strict() ReplayerOption {
+	return func(r *Replayer) {
+		r.strict = true
+	}
+}
+
+// NewReplayer loads the cassette at path, failing the test if it cannot be read.
+func NewReplayer(t testing.TB, path string, opts ...ReplayerOption) *Replayer {
+	t.Helper()
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading cassette: %v", err)
+	}
+
+	r := &Replayer{
+		t:            t,
+		match:        MatchAll,
+		interactions: c.Interactions,
+		used:         make([]bool, len(c.Interactions)),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.strict {
+		t.Cleanup(r.checkUnused)
+	}
+	return r
+}
+
+func (r *Replayer) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	got := newRequest(req, body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || !r.matches(interaction.Request, got) {
+			continue
+		}
+		r.used[i] = true
+		return interaction.Response.toHTTP(req), nil
+	}
+
+	err = fmt.Errorf("%w: %s %s", ErrNoInteraction, got.Method, got.URL)
+	if r.strict {
+		r.t.Errorf("%v", err)
+	}
+	return nil, err
+}
+
+func (r *Replayer) matches(recorded, got Request) bool {
+	if r.match&MatchMethod != 0 && recorded.Method != got.Method {
+		return false
+	}
+	if r.match&MatchURL != 0 && recorded.URL != got.URL {
+		return false
+	}
+	if r.match&MatchBody != 0 && recorded.BodyHash != got.BodyHash {
+		return false
+	}
+	return true
+}
+
+func (r *Replayer) checkUnused() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, used := range r.used {
+		if !used {
+			req := r.interactions[i].Request
+			r.t.Errorf("cassette: interaction %d (%s %s) was not used", i, req.Method, req.URL)
+		}
+	}
+}
+
+func (r Response) toHTTP(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads the request body and replaces it, so the request can still be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func newRequest(req *http.Request, body []byte) Request {
+	hash := sha256.Sum256(body)
+	return Request{
+		Method:   req.Method,
+		URL:      req.URL.RequestURI(),
+		BodyHash: hex.EncodeToString(hash[:]),
+	}
+}
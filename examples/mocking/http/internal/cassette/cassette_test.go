@@ -0,0 +1,186 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeTB captures errors reported by the replayer, so strict mode failures can be asserted.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) finish() {
+	for _, fn := range f.cleanups {
+		fn()
+	}
+}
+
+// setupSizeServer returns a server responding with the size of the request body.
+func setupSizeServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strconv.Itoa(len(body))))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func send(t *testing.T, doer Doer, method, url, body string) (*http.Response, error) {
+	t.Helper()
+	request, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doer.Do(request)
+}
+
+func readAll(t *testing.T, response *http.Response) string {
+	t.Helper()
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// record creates a cassette with two interactions and returns its path.
+func record(t *testing.T) string {
+	srv := setupSizeServer(t)
+	path := filepath.Join(t.TempDir(), "size.json")
+
+	// The recorder saves the cassette in its own sub-test cleanup.
+	t.Run("record", func(t *testing.T) {
+		recorder := NewRecorder(t, path, srv.Client())
+		for _, body := range []string{"123", "123456"} {
+			response, err := send(t, recorder, http.MethodPost, srv.URL+"/size?v=1", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The recorder must not consume the real response body.
+			if got := readAll(t, response); got != strconv.Itoa(len(body)) {
+				t.Fatalf("expected `%d`, got `%s`", len(body), got)
+			}
+		}
+	})
+	return path
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := record(t)
+
+	t.Run("replay", func(t *testing.T) {
+		replayer := NewReplayer(t, path, Strict())
+
+		// A different host is used on purpose, only the path and query are matched.
+		for _, body := range []string{"123456", "123"} {
+			response, err := send(t, replayer, http.MethodPost, "http://replay.host/size?v=1", body)
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("expected 200, got %d", response.StatusCode)
+			}
+			if got := readAll(t, response); got != strconv.Itoa(len(body)) {
+				t.Errorf("expected `%d`, got `%s`", len(body), got)
+			}
+		}
+	})
+	t.Run("matching", func(t *testing.T) {
+		cases := map[string]struct {
+			match   Match
+			method  string
+			path    string
+			body    string
+			wantErr error
+		}{
+			"all":           {match: MatchAll, method: http.MethodPost, path: "/size?v=1", body: "123"},
+			"wrong_method":  {match: MatchAll, method: http.MethodPut, path: "/size?v=1", body: "123", wantErr: ErrNoInteraction},
+			"wrong_url":     {match: MatchAll, method: http.MethodPost, path: "/size?v=2", body: "123", wantErr: ErrNoInteraction},
+			"wrong_body":    {match: MatchAll, method: http.MethodPost, path: "/size?v=1", body: "1234", wantErr: ErrNoInteraction},
+			"ignore_method": {match: MatchURL | MatchBody, method: http.MethodPut, path: "/size?v=1", body: "123"},
+			"ignore_url":    {match: MatchMethod | MatchBody, method: http.MethodPost, path: "/other", body: "123"},
+			"ignore_body":   {match: MatchMethod | MatchURL, method: http.MethodPost, path: "/size?v=1", body: "1234"},
+			"method_only":   {match: MatchMethod, method: http.MethodPost, path: "/", body: ""},
+		}
+		for name, tt := range cases {
+			t.Run(name, func(t *testing.T) {
+				replayer := NewReplayer(t, path, WithMatch(tt.match))
+
+				response, err := send(t, replayer, tt.method, "http://replay.host"+tt.path, tt.body)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				if err == nil {
+					response.Body.Close()
+				}
+			})
+		}
+	})
+	t.Run("used_once", func(t *testing.T) {
+		replayer := NewReplayer(t, path)
+
+		// Only one recorded interaction matches the body "123", so the second request fails.
+		for i := range 2 {
+			response, err := send(t, replayer, http.MethodPost, "http://replay.host/size?v=1", "123")
+			if i == 1 {
+				if !errors.Is(err, ErrNoInteraction) {
+					t.Fatalf("expected %v, got %v", ErrNoInteraction, err)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			response.Body.Close()
+		}
+	})
+	t.Run("strict_unmatched", func(t *testing.T) {
+		tb := &fakeTB{TB: t}
+		replayer := NewReplayer(tb, path, Strict())
+
+		if _, err := send(t, replayer, http.MethodGet, "http://replay.host/", ""); !errors.Is(err, ErrNoInteraction) {
+			t.Fatalf("expected %v, got %v", ErrNoInteraction, err)
+		}
+		tb.finish()
+
+		// One unmatched request and two unused interactions.
+		if len(tb.errors) != 3 {
+			t.Errorf("expected 3 test errors, got %d: %v", len(tb.errors), tb.errors)
+		}
+	})
+	t.Run("lenient_unmatched", func(t *testing.T) {
+		tb := &fakeTB{TB: t}
+		replayer := NewReplayer(tb, path)
+
+		if _, err := send(t, replayer, http.MethodGet, "http://replay.host/", ""); !errors.Is(err, ErrNoInteraction) {
+			t.Fatalf("expected %v, got %v", ErrNoInteraction, err)
+		}
+		tb.finish()
+
+		if len(tb.errors) != 0 {
+			t.Errorf("expected no test errors, got %v", tb.errors)
+		}
+	})
+}
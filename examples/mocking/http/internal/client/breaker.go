@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// StateClosed lets all requests through while counting consecutive failures.
+	StateClosed BreakerState = iota
+	// StateOpen rejects all requests with ErrCircuitOpen until the cooldown passes.
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through to check whether the server recovered.
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures a CircuitBreaker. Zero values are replaced with defaults.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit. Defaults to 5.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before allowing probes. Defaults to 30s.
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of concurrent probes allowed in the half-open state. Defaults to 1.
+	HalfOpenRequests int
+	// IsFailure decides whether a call counts as a failure. Defaults to transport errors and 5xx responses.
+	IsFailure func(*http.Response, error) bool
+	// Clock is used to measure the cooldown. Defaults to the real clock.
+	Clock clockwork.Clock
+}
+
+// CircuitBreaker is a Doer decorator which stops calling a failing server for a while,
+// failing fast with ErrCircuitOpen instead. It is safe for concurrent use.
+type CircuitBreaker struct {
+	next   Doer
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	// probes is the number of requests in flight in the half-open state.
+	probes int
+	// generation changes with every state transition, so outcomes of requests admitted
+	// in an earlier state are ignored.
+	generation uint64
+}
+
+// outcome is the effect of a finished request on the breaker.
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	// ignored requests, such as cancelled ones, say nothing about the server and leave the state untouched.
+	ignored
+)
+
+func NewCircuitBreaker(next Doer, config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isServerFailure
+	}
+	if config.Clock == nil {
+		config.Clock = clockwork.NewRealClock()
+	}
+	return &CircuitBreaker{
+		next:   next,
+		config: config,
+	}
+}
+
+func (b *CircuitBreaker) Do(r *http.Request) (*http.Response, error) {
+	generation, err := b.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := b.next.Do(r)
+	b.record(generation, b.classify(response, err))
+	return response, err
+}
+
+// classify turns the result of a request into an outcome.
+// A cancelled request which IsFailure does not count as a failure is ignored rather than counted as a success.
+func (b *CircuitBreaker) classify(response *http.Response, err error) outcome {
+	switch {
+	case b.config.IsFailure(response, err):
+		return failure
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return ignored
+	default:
+		return success
+	}
+}
+
+// State returns the current state, moving from open to half-open once the cooldown passed.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkCooldown()
+	return b.state
+}
+
+// acquire checks whether a request may be sent and returns the generation it is admitted in.
+func (b *CircuitBreaker) acquire() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkCooldown()
+	switch b.state {
+	case StateOpen:
+		return 0, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.config.HalfOpenRequests {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// record updates the state with the outcome of a request admitted in the given generation.
+func (b *CircuitBreaker) record(generation uint64, result outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		// The request was admitted before the last transition, e.g. while closed, and finished after
+		// the circuit opened or went half-open, so its outcome says nothing about the current state.
+		return
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		switch result {
+		case failure:
+			b.open()
+		case success:
+			b.transition(StateClosed)
+		}
+	case StateClosed:
+		switch result {
+		case failure:
+			b.failures++
+			if b.failures >= b.config.FailureThreshold {
+				b.open()
+			}
+		case success:
+			b.failures = 0
+		}
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.transition(StateOpen)
+	b.openedAt = b.config.Clock.Now()
+}
+
+// transition moves to state, starting a new generation. The caller must hold the lock.
+func (b *CircuitBreaker) transition(state BreakerState) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+}
+
+// checkCooldown moves an open circuit to half-open once the cooldown passed. The caller must hold the lock.
+func (b *CircuitBreaker) checkCooldown() {
+	if b.state == StateOpen && b.config.Clock.Since(b.openedAt) >= b.config.Cooldown {
+		b.transition(StateHalfOpen)
+	}
+}
+
+// isServerFailure treats transport errors and 5xx responses as failures.
+// A cancelled request says nothing about the server, so it is not counted.
+func isServerFailure(response *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return response.StatusCode >= http.StatusInternalServerError
+}
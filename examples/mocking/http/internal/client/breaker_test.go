@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// switchDoer fails with a transport error while failing is set.
+type switchDoer struct {
+	mu      sync.Mutex
+	failing bool
+	calls   int
+	// block, when set, is waited on before responding.
+	block chan struct{}
+}
+
+func (d *switchDoer) Do(r *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.calls++
+	failing, block := d.failing, d.block
+	d.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+	if failing {
+		return nil, syscall.ECONNREFUSED
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (d *switchDoer) set(failing bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failing = failing
+}
+
+func setupBreaker(doer Doer) (*CircuitBreaker, *clockwork.FakeClock) {
+	clock := clockwork.NewFakeClock()
+	return NewCircuitBreaker(doer, BreakerConfig{
+		FailureThreshold: 3,
+		Cooldown:         time.Minute,
+		Clock:            clock,
+	}), clock
+}
+
+func call(t *testing.T, b *CircuitBreaker) error {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, "http://size.server", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := b.Do(request)
+	if err == nil {
+		response.Body.Close()
+	}
+	return err
+}
+
+func expectState(t *testing.T, b *CircuitBreaker, want BreakerState) {
+	t.Helper()
+	if got := b.State(); got != want {
+		t.Fatalf("expected state %s, got %s", want, got)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("opens_after_threshold", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, _ := setupBreaker(doer)
+
+		for range 3 {
+			expectState(t, breaker, StateClosed)
+			if err := call(t, breaker); !errors.Is(err, syscall.ECONNREFUSED) {
+				t.Fatalf("expected connection refused, got %v", err)
+			}
+		}
+		expectState(t, breaker, StateOpen)
+
+		if err := call(t, breaker); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+		}
+		if doer.calls != 3 {
+			t.Errorf("expected open circuit not to call the Doer, got %d calls", doer.calls)
+		}
+	})
+	t.Run("success_resets_failures", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, _ := setupBreaker(doer)
+
+		call(t, breaker)
+		call(t, breaker)
+		doer.set(false)
+		call(t, breaker)
+		doer.set(true)
+		call(t, breaker)
+		call(t, breaker)
+
+		expectState(t, breaker, StateClosed)
+	})
+	t.Run("half_open_success_closes", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, clock := setupBreaker(doer)
+		for range 3 {
+			call(t, breaker)
+		}
+
+		clock.Advance(59 * time.Second)
+		expectState(t, breaker, StateOpen)
+		clock.Advance(time.Second)
+		expectState(t, breaker, StateHalfOpen)
+
+		doer.set(false)
+		if err := call(t, breaker); err != nil {
+			t.Fatalf("expected probe to succeed, got `%s`", err.Error())
+		}
+		expectState(t, breaker, StateClosed)
+	})
+	t.Run("half_open_failure_reopens", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, clock := setupBreaker(doer)
+		for range 3 {
+			call(t, breaker)
+		}
+
+		clock.Advance(time.Minute)
+		if err := call(t, breaker); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("expected probe to reach the Doer, got %v", err)
+		}
+		expectState(t, breaker, StateOpen)
+
+		// The cooldown starts again from the failed probe.
+		clock.Advance(30 * time.Second)
+		expectState(t, breaker, StateOpen)
+		clock.Advance(30 * time.Second)
+		expectState(t, breaker, StateHalfOpen)
+	})
+	t.Run("half_open_limits_probes", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, clock := setupBreaker(doer)
+		for range 3 {
+			call(t, breaker)
+		}
+		clock.Advance(time.Minute)
+
+		doer.mu.Lock()
+		doer.failing = false
+		doer.block = make(chan struct{})
+		release := doer.block
+		doer.mu.Unlock()
+
+		probeErr := make(chan error)
+		go func() {
+			request, _ := http.NewRequest(http.MethodGet, "http://size.server", nil)
+			_, err := breaker.Do(request)
+			probeErr <- err
+		}()
+
+		// Wait until the probe reached the Doer, then any other request must be rejected.
+		for {
+			doer.mu.Lock()
+			calls := doer.calls
+			doer.mu.Unlock()
+			if calls == 4 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := call(t, breaker); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected %v while probing, got %v", ErrCircuitOpen, err)
+		}
+
+		close(release)
+		if err := <-probeErr; err != nil {
+			t.Fatalf("expected probe to succeed, got `%s`", err.Error())
+		}
+		expectState(t, breaker, StateClosed)
+	})
+	t.Run("cancelled_ignored", func(t *testing.T) {
+		var fail error
+		doer := doerFunc(func(*http.Request) (*http.Response, error) {
+			if fail != nil {
+				return nil, fail
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+		breaker, clock := setupBreaker(doer)
+
+		// A cancelled request between failures does not reset the count.
+		fail = syscall.ECONNREFUSED
+		call(t, breaker)
+		call(t, breaker)
+		fail = context.Canceled
+		call(t, breaker)
+		expectState(t, breaker, StateClosed)
+		fail = syscall.ECONNREFUSED
+		call(t, breaker)
+		expectState(t, breaker, StateOpen)
+
+		// A cancelled probe neither closes nor reopens the circuit, but frees its slot.
+		clock.Advance(time.Minute)
+		fail = context.DeadlineExceeded
+		call(t, breaker)
+		expectState(t, breaker, StateHalfOpen)
+		fail = nil
+		if err := call(t, breaker); err != nil {
+			t.Fatalf("expected probe to succeed, got `%s`", err.Error())
+		}
+		expectState(t, breaker, StateClosed)
+	})
+	t.Run("stale_outcome_ignored", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		var slow sync.Once
+		doer := doerFunc(func(*http.Request) (*http.Response, error) {
+			first := false
+			slow.Do(func() { first = true })
+			if !first {
+				return nil, syscall.ECONNREFUSED
+			}
+			close(started)
+			<-release
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+		breaker, clock := setupBreaker(doer)
+
+		// A request admitted while closed is still in flight when the circuit opens and goes half-open.
+		slowErr := make(chan error)
+		go func() {
+			slowErr <- call(t, breaker)
+		}()
+		<-started
+		for range 3 {
+			call(t, breaker)
+		}
+		expectState(t, breaker, StateOpen)
+		clock.Advance(time.Minute)
+		expectState(t, breaker, StateHalfOpen)
+
+		// Its success does not close the circuit nor take a probe slot which it never had.
+		close(release)
+		if err := <-slowErr; err != nil {
+			t.Fatalf("expected the slow request to succeed, got `%s`", err.Error())
+		}
+		expectState(t, breaker, StateHalfOpen)
+		if err := call(t, breaker); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("expected the probe to reach the Doer, got %v", err)
+		}
+		expectState(t, breaker, StateOpen)
+	})
+	t.Run("client", func(t *testing.T) {
+		doer := &switchDoer{failing: true}
+		breaker, _ := setupBreaker(doer)
+		client := NewClient("http://size.server", breaker)
+
+		for range 3 {
+			client.GetSize([]byte("123"))
+		}
+		if _, err := client.GetSize([]byte("123")); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+		}
+	})
+}
+
+func TestIsServerFailure(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		err    error
+		want   bool
+	}{
+		"ok":         {status: http.StatusOK, want: false},
+		"client_4xx": {status: http.StatusNotFound, want: false},
+		"server_5xx": {status: http.StatusBadGateway, want: true},
+		"transport":  {err: syscall.ECONNRESET, want: true},
+		"cancelled":  {err: context.Canceled, want: false},
+		"deadline":   {err: context.DeadlineExceeded, want: false},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var response *http.Response
+			if tt.err == nil {
+				response = &http.Response{StatusCode: tt.status}
+			}
+			if got := isServerFailure(response, tt.err); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
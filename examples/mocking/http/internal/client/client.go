@@ -2,10 +2,20 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // Doer represents minimal interface requiring basic http.Client functionality
@@ -22,8 +32,22 @@ type Client struct {
 	//		3. Substitute with a different client for testing
 	client Doer
 	URI    string
+	// Compression compresses request bodies with the given encoding. The zero value sends them as they are.
+	// When the server rejects the encoding with 415, the request is sent once more with an encoding
+	// listed in the Accept-Encoding header of the response, or uncompressed.
+	Compression Encoding
 }
 
+// Encoding is a Content-Encoding of request bodies supported by Server.
+type Encoding string
+
+const (
+	Identity Encoding = ""
+	Gzip     Encoding = "gzip"
+	Deflate  Encoding = "deflate"
+	Zstd     Encoding = "zstd"
+)
+
 func NewClient(URI string, client Doer) *Client {
 	if client == nil {
 		client = http.DefaultClient
@@ -34,33 +58,215 @@ func NewClient(URI string, client Doer) *Client {
 	}
 }
 
+// GetSize is GetSizeContext with the background context.
 func (c Client) GetSize(data []byte) (int, error) {
-	request, err := http.NewRequest(http.MethodGet, c.URI, bytes.NewBuffer(data))
+	return c.GetSizeContext(context.Background(), data)
+}
+
+// GetSizeContext returns the size of data computed by the server.
+// The request is bound to ctx, so cancelling ctx or reaching its deadline aborts the call.
+func (c Client) GetSizeContext(ctx context.Context, data []byte) (int, error) {
+	respData, isJSON, err := c.send(ctx, "", data)
 	if err != nil {
 		return 0, err
 	}
 
-	response, err := c.client.Do(request)
+	if isJSON {
+		var resp struct {
+			Size int `json:"size"`
+		}
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			return 0, errors.Join(ErrInvalidResponse, err)
+		}
+		return resp.Size, nil
+	}
+
+	out, err := strconv.Atoi(string(respData))
 	if err != nil {
-		return 0, err
+		// Wrapping the general error with our domain error for handling down the line
+		return 0, errors.Join(ErrInvalidResponse, err)
+	}
+	return out, nil
+}
+
+// HashAlgorithm is a checksum algorithm supported by GetHash.
+type HashAlgorithm string
+
+const (
+	SHA256 HashAlgorithm = "sha256"
+	MD5    HashAlgorithm = "md5"
+	CRC32  HashAlgorithm = "crc32"
+)
+
+// GetHash returns the hex encoded checksum of data computed by the server.
+func (c Client) GetHash(ctx context.Context, data []byte, algorithm HashAlgorithm) (string, error) {
+	respData, isJSON, err := c.send(ctx, "/hash/"+string(algorithm), data)
+	if err != nil {
+		return "", err
+	}
+
+	if isJSON {
+		var resp struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			return "", errors.Join(ErrInvalidResponse, err)
+		}
+		return resp.Hash, nil
+	}
+	return string(respData), nil
+}
+
+// ContentStats holds the statistics of a payload returned by GetStats.
+type ContentStats struct {
+	Bytes int `json:"bytes"`
+	Runes int `json:"runes"`
+	Lines int `json:"lines"`
+	Words int `json:"words"`
+}
+
+// GetStats returns byte, rune, line and word counts of data computed by the server.
+func (c Client) GetStats(ctx context.Context, data []byte) (ContentStats, error) {
+	respData, _, err := c.send(ctx, "/stats", data)
+	if err != nil {
+		return ContentStats{}, err
+	}
+
+	var stats ContentStats
+	if err := json.Unmarshal(respData, &stats); err != nil {
+		return ContentStats{}, errors.Join(ErrInvalidResponse, err)
+	}
+	return stats, nil
+}
+
+// GetMIME returns the MIME type of data detected by the server.
+func (c Client) GetMIME(ctx context.Context, data []byte) (string, error) {
+	respData, isJSON, err := c.send(ctx, "/mime", data)
+	if err != nil {
+		return "", err
+	}
+
+	if isJSON {
+		var resp struct {
+			MIME string `json:"mime"`
+		}
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			return "", errors.Join(ErrInvalidResponse, err)
+		}
+		return resp.MIME, nil
+	}
+	return string(respData), nil
+}
+
+// send posts data to the endpoint at path, relative to URI, and returns the response body.
+// It asks for JSON and reports whether the server responded with it; older servers respond with plain text.
+func (c Client) send(ctx context.Context, path string, data []byte) ([]byte, bool, error) {
+	uri := c.URI
+	if path != "" {
+		uri = strings.TrimSuffix(uri, "/") + path
+	}
+	response, err := c.post(ctx, uri, data, c.Compression)
+	if err != nil {
+		return nil, false, err
+	}
+	if response.StatusCode == http.StatusUnsupportedMediaType && c.Compression != Identity {
+		// The server does not accept our encoding, it lists the ones it does instead.
+		if fallback := acceptedEncoding(response.Header.Get("Accept-Encoding")); fallback != c.Compression {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+			if response, err = c.post(ctx, uri, data, fallback); err != nil {
+				return nil, false, err
+			}
+		}
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+		return nil, false, newStatusError(response)
 	}
 
-	respData, err := io.ReadAll(response.Body)
+	body, err := io.ReadAll(response.Body)
+	return body, hasMediaType(response, "application/json"), err
+}
+
+// post sends data encoded with encoding to uri.
+func (c Client) post(ctx context.Context, uri string, data []byte, encoding Encoding) (*http.Response, error) {
+	payload, err := compress(data, encoding)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	out, err := strconv.Atoi(string(respData))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(payload))
 	if err != nil {
-		return 0, ErrInvalidResponse
+		return nil, err
+	}
+	if encoding != Identity {
+		request.Header.Set("Content-Encoding", string(encoding))
+	}
+	request.Header.Set("Accept", "application/json, text/plain;q=0.9")
+	// The endpoints only compute over the payload, so repeating a call is safe and RetryDoer may retry it.
+	request.Header.Set("Idempotency-Key", rand.Text())
 
-		// Wrapping the general error with our domain error for handling down the line
-		//return 0, errors.Join(ErrInvalidResponse, err)
+	// Not every Doer checks the context before sending, so we do not even start a cancelled call.
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return out, nil
+	return c.client.Do(request)
+}
+
+// acceptedEncoding returns the first encoding we support from the Accept-Encoding header of a 415 response,
+// or Identity when there is none.
+func acceptedEncoding(header string) Encoding {
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && weight == 0 {
+				// Explicitly not acceptable.
+				continue
+			}
+		}
+		switch encoding := Encoding(strings.ToLower(strings.TrimSpace(name))); encoding {
+		case Gzip, Deflate, Zstd:
+			return encoding
+		}
+	}
+	return Identity
+}
+
+// hasMediaType reports whether the Content-Type of response is mediaType.
+func hasMediaType(response *http.Response, mediaType string) bool {
+	got, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	return err == nil && got == mediaType
+}
+
+// zstdEncoder is shared by all clients, EncodeAll is safe for concurrent use.
+// The window stays within the 8MB a server has to accept, see RFC 9659.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+
+// compress encodes data with encoding.
+func compress(data []byte, encoding Encoding) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case Identity:
+		return data, nil
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Deflate:
+		// HTTP deflate is the zlib format rather than raw deflate.
+		w = zlib.NewWriter(&buf)
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
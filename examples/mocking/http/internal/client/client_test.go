@@ -1,12 +1,23 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/synctest"
+	"time"
+
+	"mocking_http/internal/cassette"
+	"mocking_http/internal/doertest"
+	"mocking_http/internal/server"
 )
 
 func setupTestServer(resp []byte) *httptest.Server {
@@ -75,13 +86,592 @@ func TestClient_GetSize(t *testing.T) {
 		}
 
 		// Note: Golang supports error wrapping which means you should not compare errors directly.
-		// Use `errors.Is` instead
-		if err != ErrInvalidResponse {
-			t.Fatalf("expected invalid response error, got `%s`", err.Error())
+		// Use `errors.Is` instead. The returned error wraps ErrInvalidResponse, so it is not equal to it.
+		if err == ErrInvalidResponse {
+			t.Fatalf("expected wrapped invalid response error, got `%s`", err.Error())
 		}
 
 		if !errors.Is(err, ErrInvalidResponse) {
 			t.Fatalf("expected invalid response error, got `%s`", err.Error())
 		}
+
+		// The underlying parsing error is still reachable with `errors.As`.
+		var numErr *strconv.NumError
+		if !errors.As(err, &numErr) {
+			t.Fatalf("expected strconv.NumError, got `%s`", err.Error())
+		}
+	})
+	t.Run("status_error", func(t *testing.T) {
+		cases := map[string]struct {
+			status  int
+			body    string
+			wantErr error
+		}{
+			"client_error": {status: http.StatusBadRequest, body: "bad request", wantErr: ErrClientError},
+			"server_error": {status: http.StatusBadGateway, body: "bad gateway", wantErr: ErrServerError},
+		}
+		for name, tt := range cases {
+			t.Run(name, func(t *testing.T) {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+				}))
+				defer srv.Close()
+
+				client := NewClient(srv.URL, srv.Client())
+
+				_, err := client.GetSize([]byte("123"))
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got `%v`", tt.wantErr, err)
+				}
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) {
+					t.Fatalf("expected StatusError, got `%v`", err)
+				}
+				if statusErr.StatusCode != tt.status || statusErr.Body != tt.body {
+					t.Fatalf("expected status %d with body `%s`, got %d with `%s`", tt.status, tt.body, statusErr.StatusCode, statusErr.Body)
+				}
+			})
+		}
+	})
+}
+
+// setupStallingServer returns a server which never responds. It is closed at the end of the test.
+func setupStallingServer(t *testing.T) *httptest.Server {
+	stop := make(chan struct{})
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	})
+
+	srv := httptest.NewServer(handlerFn)
+	// Close waits for running handlers, so they need to be released first.
+	t.Cleanup(func() {
+		close(stop)
+		srv.Close()
+	})
+	return srv
+}
+
+// ctxDoer is a Doer which waits for the request context before returning its error.
+type ctxDoer struct {
+	calls int
+}
+
+func (d *ctxDoer) Do(r *http.Request) (*http.Response, error) {
+	d.calls++
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func TestClient_GetSizeContext(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		input := []byte("123456789")
+		srv := setupTestServer([]byte("9"))
+		defer srv.Close()
+
+		client := NewClient(srv.URL, srv.Client())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		got, err := client.GetSizeContext(ctx, input)
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got != len(input) {
+			t.Fatalf("expected %d, got %d", len(input), got)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		srv := setupStallingServer(t)
+
+		client := NewClient(srv.URL, srv.Client())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.GetSizeContext(ctx, []byte("123"))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got `%v`", err)
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		srv := setupStallingServer(t)
+
+		client := NewClient(srv.URL, srv.Client())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		_, err := client.GetSizeContext(ctx, []byte("123"))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got `%v`", err)
+		}
+	})
+	t.Run("doer_timeout", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &ctxDoer{}
+			client := NewClient("http://size.server", doer)
+
+			ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+			defer cancel()
+			_, err := client.GetSizeContext(ctx, []byte("123"))
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded error, got `%v`", err)
+			}
+			if doer.calls != 1 {
+				t.Fatalf("expected 1 call, got %d", doer.calls)
+			}
+		})
+	})
+	t.Run("already_cancelled", func(t *testing.T) {
+		doer := &ctxDoer{}
+		client := NewClient("http://size.server", doer)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.GetSizeContext(ctx, []byte("123"))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got `%v`", err)
+		}
+		if doer.calls != 0 {
+			t.Fatalf("expected the Doer not to be called, got %d calls", doer.calls)
+		}
+	})
+}
+
+// TestClient_GetSize_Cassette replays responses recorded from the real Server instead of starting one.
+// Run it with RECORD_CASSETTES=1 to record the cassette again.
+func TestClient_GetSize_Cassette(t *testing.T) {
+	path := filepath.Join("testdata", "get_size.json")
+
+	var (
+		doer Doer
+		uri  = "http://size.server"
+	)
+	if os.Getenv("RECORD_CASSETTES") == "1" {
+		srv := httptest.NewServer(&server.Server{})
+		t.Cleanup(srv.Close)
+		doer = cassette.NewRecorder(t, path, srv.Client())
+		uri = srv.URL
+	} else {
+		doer = cassette.NewReplayer(t, path, cassette.Strict())
+	}
+	client := NewClient(uri, doer)
+
+	for _, input := range []string{"", "1", "123456789", "Hello World!"} {
+		got, err := client.GetSize([]byte(input))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got != len(input) {
+			t.Errorf("expected %d, got %d", len(input), got)
+		}
+	}
+}
+
+func TestClient_GetSize_Fake(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, "9").ExpectBody("123456789")
+
+		client := NewClient("http://size.server", fake)
+
+		got, err := client.GetSize([]byte("123456789"))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got != 9 {
+			t.Fatalf("expected 9, got %d", got)
+		}
+	})
+	t.Run("retried", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			fake := doertest.New(t)
+			fake.Respond(http.StatusServiceUnavailable, "busy").Times(2)
+			fake.Respond(http.StatusOK, "3")
+			fake.ExpectCalls(3)
+
+			client := NewClient("http://size.server", NewRetryDoer(fake, DefaultRetryPolicy()))
+
+			got, err := client.GetSize([]byte("abc"))
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if got != 3 {
+				t.Fatalf("expected 3, got %d", got)
+			}
+			// Every attempt carries the full payload.
+			for i, body := range fake.Bodies() {
+				if body != "abc" {
+					t.Errorf("attempt %d: expected body `abc`, got `%s`", i+1, body)
+				}
+			}
+		})
+	})
+	t.Run("transport_error", func(t *testing.T) {
+		expectedErr := errors.New("connection reset")
+		fake := doertest.New(t)
+		fake.Fail(expectedErr)
+
+		client := NewClient("http://size.server", fake)
+
+		if _, err := client.GetSize([]byte("abc")); !errors.Is(err, expectedErr) {
+			t.Fatalf("expected %v, got %v", expectedErr, err)
+		}
+	})
+}
+
+func TestClient_Analysis(t *testing.T) {
+	t.Run("hash", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, "202cb962ac59075b964b07152d234b70").ExpectBody("123")
+
+		client := NewClient("http://size.server/", fake)
+
+		got, err := client.GetHash(t.Context(), []byte("123"), MD5)
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got != "202cb962ac59075b964b07152d234b70" {
+			t.Fatalf("expected md5 checksum, got `%s`", got)
+		}
+		if path := fake.Requests()[0].URL.Path; path != "/hash/md5" {
+			t.Fatalf("expected path /hash/md5, got `%s`", path)
+		}
+	})
+	t.Run("stats", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, `{"bytes":6,"runes":6,"lines":2,"words":3}`)
+
+		client := NewClient("http://size.server", fake)
+
+		got, err := client.GetStats(t.Context(), []byte("a b\nc\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		want := ContentStats{Bytes: 6, Runes: 6, Lines: 2, Words: 3}
+		if got != want {
+			t.Fatalf("expected %+v, got %+v", want, got)
+		}
+	})
+	t.Run("stats_invalid", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, `not json`)
+
+		client := NewClient("http://size.server", fake)
+
+		if _, err := client.GetStats(t.Context(), []byte("abc")); !errors.Is(err, ErrInvalidResponse) {
+			t.Fatalf("expected invalid response error, got `%v`", err)
+		}
+	})
+	t.Run("mime", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, "text/plain; charset=utf-8")
+
+		client := NewClient("http://size.server", fake)
+
+		got, err := client.GetMIME(t.Context(), []byte("hello"))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got != "text/plain; charset=utf-8" {
+			t.Fatalf("expected text/plain, got `%s`", got)
+		}
+		if path := fake.Requests()[0].URL.Path; path != "/mime" {
+			t.Fatalf("expected path /mime, got `%s`", path)
+		}
+	})
+	t.Run("server", func(t *testing.T) {
+		// The typed methods must agree with the real Server.
+		srv := httptest.NewServer(&server.Server{})
+		defer srv.Close()
+
+		client := NewClient(srv.URL, srv.Client())
+		input := []byte("hello world\n")
+
+		hash, err := client.GetHash(t.Context(), input, SHA256)
+		if err != nil || len(hash) != 64 {
+			t.Errorf("expected sha256 checksum, got `%s` (%v)", hash, err)
+		}
+		stats, err := client.GetStats(t.Context(), input)
+		if err != nil || stats != (ContentStats{Bytes: 12, Runes: 12, Lines: 1, Words: 2}) {
+			t.Errorf("expected stats of the input, got %+v (%v)", stats, err)
+		}
+		mime, err := client.GetMIME(t.Context(), input)
+		if err != nil || mime != "text/plain; charset=utf-8" {
+			t.Errorf("expected text/plain, got `%s` (%v)", mime, err)
+		}
+		if _, err := client.GetHash(t.Context(), input, "sha1"); !errors.Is(err, ErrClientError) {
+			t.Errorf("expected client error for an unsupported algorithm, got %v", err)
+		}
+	})
+}
+
+func TestClient_Formats(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, "3")
+
+		client := NewClient("http://size.server", fake)
+
+		if _, err := client.GetSize([]byte("abc")); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		request := fake.Requests()[0]
+		if request.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", request.Method)
+		}
+		if accept := request.Header.Get("Accept"); !strings.Contains(accept, "application/json") {
+			t.Errorf("expected to accept JSON, got `%s`", accept)
+		}
+		// The key lets RetryDoer retry the POST.
+		if !IsIdempotent(request) {
+			t.Errorf("expected an idempotent request")
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, `{"size":9}`).Header("Content-Type", "application/json")
+		fake.Respond(http.StatusOK, `{"algorithm":"md5","hash":"202cb962ac59075b964b07152d234b70"}`).Header("Content-Type", "application/json")
+		fake.Respond(http.StatusOK, `{"mime":"image/png"}`).Header("Content-Type", "application/json; charset=utf-8")
+
+		client := NewClient("http://size.server", fake)
+
+		size, err := client.GetSize([]byte("123456789"))
+		if err != nil || size != 9 {
+			t.Errorf("expected 9, got %d (%v)", size, err)
+		}
+		hash, err := client.GetHash(t.Context(), []byte("123"), MD5)
+		if err != nil || hash != "202cb962ac59075b964b07152d234b70" {
+			t.Errorf("expected md5 checksum, got `%s` (%v)", hash, err)
+		}
+		mime, err := client.GetMIME(t.Context(), []byte("png"))
+		if err != nil || mime != "image/png" {
+			t.Errorf("expected image/png, got `%s` (%v)", mime, err)
+		}
+	})
+	t.Run("json_invalid", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, `9`).Header("Content-Type", "application/json")
+		fake.Respond(http.StatusOK, `{"hash":`).Header("Content-Type", "application/json")
+
+		client := NewClient("http://size.server", fake)
+
+		if _, err := client.GetSize([]byte("abc")); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("expected invalid response error, got `%v`", err)
+		}
+		if _, err := client.GetHash(t.Context(), []byte("abc"), MD5); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("expected invalid response error, got `%v`", err)
+		}
+	})
+	t.Run("problem", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusRequestEntityTooLarge, `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"request body exceeds 10 bytes"}`).
+			Header("Content-Type", "application/problem+json")
+
+		client := NewClient("http://size.server", fake)
+
+		_, err := client.GetSize([]byte("abc"))
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("expected StatusError, got `%v`", err)
+		}
+		if statusErr.Title != "Request Entity Too Large" || statusErr.Detail != "request body exceeds 10 bytes" {
+			t.Fatalf("expected problem details, got %+v", statusErr)
+		}
+		if want := "unexpected status code: 413: request body exceeds 10 bytes"; err.Error() != want {
+			t.Fatalf("expected `%s`, got `%s`", want, err.Error())
+		}
+	})
+	t.Run("server", func(t *testing.T) {
+		srv := httptest.NewServer(&server.Server{MaxBodySize: 4})
+		defer srv.Close()
+
+		client := NewClient(srv.URL, srv.Client())
+
+		if got, err := client.GetSize([]byte("1234")); err != nil || got != 4 {
+			t.Fatalf("expected 4, got %d (%v)", got, err)
+		}
+		_, err := client.GetSize([]byte("12345"))
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusRequestEntityTooLarge || statusErr.Detail == "" {
+			t.Fatalf("expected 413 with problem details, got `%v`", err)
+		}
+	})
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	cases := map[string]Encoding{
+		"":                    Identity,
+		"gzip":                Gzip,
+		"br, zstd, gzip":      Zstd,
+		" DEFLATE ;q=0.5":     Deflate,
+		"gzip;q=0, deflate":   Deflate,
+		"gzip; q=0":           Identity,
+		"br, identity":        Identity,
+		"compress, x-unknown": Identity,
+	}
+	for header, want := range cases {
+		if got := acceptedEncoding(header); got != want {
+			t.Errorf("%q: expected %q, got %q", header, want, got)
+		}
+	}
+}
+
+func TestClient_Compression(t *testing.T) {
+	payload := []byte(strings.Repeat("hello world ", 100))
+
+	for _, encoding := range []Encoding{Gzip, Deflate, Zstd} {
+		t.Run(string(encoding), func(t *testing.T) {
+			fake := doertest.New(t)
+			fake.Respond(http.StatusOK, "1200")
+
+			client := NewClient("http://size.server", fake)
+			client.Compression = encoding
+
+			if _, err := client.GetSize(payload); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			request := fake.Requests()[0]
+			if got := request.Header.Get("Content-Encoding"); got != string(encoding) {
+				t.Fatalf("expected Content-Encoding %s, got `%s`", encoding, got)
+			}
+			if sent := fake.Bodies()[0]; len(sent) >= len(payload) {
+				t.Fatalf("expected a compressed body, got %d bytes", len(sent))
+			}
+		})
+	}
+	t.Run("none", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusOK, "3").ExpectBody("abc")
+
+		client := NewClient("http://size.server", fake)
+
+		if _, err := client.GetSize([]byte("abc")); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got := fake.Requests()[0].Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("expected no Content-Encoding, got `%s`", got)
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.ExpectCalls(0)
+
+		client := NewClient("http://size.server", fake)
+		client.Compression = "br"
+
+		if _, err := client.GetSize([]byte("abc")); !errors.Is(err, ErrUnsupportedEncoding) {
+			t.Fatalf("expected unsupported encoding error, got `%v`", err)
+		}
+	})
+	t.Run("server", func(t *testing.T) {
+		// The server reports the decoded size of the compressed body.
+		srv := httptest.NewServer(&server.Server{MaxBodySize: 1500})
+		defer srv.Close()
+
+		for _, encoding := range []Encoding{Identity, Gzip, Deflate, Zstd} {
+			client := NewClient(srv.URL, srv.Client())
+			client.Compression = encoding
+
+			got, err := client.GetSize(payload)
+			if err != nil || got != len(payload) {
+				t.Errorf("%q: expected %d, got %d (%v)", encoding, len(payload), got, err)
+			}
+		}
+
+		// A body small on the wire still counts against the limit once decoded.
+		client := NewClient(srv.URL, srv.Client())
+		client.Compression = Gzip
+		_, err := client.GetSize(bytes.Repeat(payload, 2))
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got `%v`", err)
+		}
+	})
+	t.Run("fallback", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusUnsupportedMediaType, "").Header("Accept-Encoding", "br, deflate, gzip")
+		fake.Respond(http.StatusOK, "1200")
+
+		client := NewClient("http://size.server", fake)
+		client.Compression = Zstd
+
+		if _, err := client.GetSize(payload); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		// The first encoding listed by the server which we support.
+		if got := fake.Requests()[1].Header.Get("Content-Encoding"); got != string(Deflate) {
+			t.Fatalf("expected Content-Encoding %s, got `%s`", Deflate, got)
+		}
+	})
+	t.Run("fallback_identity", func(t *testing.T) {
+		fake := doertest.New(t)
+		fake.Respond(http.StatusUnsupportedMediaType, "")
+		fake.Respond(http.StatusOK, "3").ExpectBody("abc")
+
+		client := NewClient("http://size.server", fake)
+		client.Compression = Gzip
+
+		if _, err := client.GetSize([]byte("abc")); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		if got := fake.Requests()[1].Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("expected no Content-Encoding, got `%s`", got)
+		}
+	})
+	t.Run("fallback_once", func(t *testing.T) {
+		// The same encoding is not tried again, and a rejected fallback is reported.
+		fake := doertest.New(t)
+		fake.Respond(http.StatusUnsupportedMediaType, "").Header("Accept-Encoding", "gzip")
+		fake.ExpectCalls(1)
+
+		client := NewClient("http://size.server", fake)
+		client.Compression = Gzip
+
+		var statusErr *StatusError
+		if _, err := client.GetSize([]byte("abc")); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnsupportedMediaType {
+			t.Fatalf("expected 415, got `%v`", err)
+		}
+	})
+	t.Run("fallback_server", func(t *testing.T) {
+		// A server which only knows gzip.
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if encoding := r.Header.Get("Content-Encoding"); encoding != "gzip" {
+				w.Header().Set("Accept-Encoding", "gzip")
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			(&server.Server{}).ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+
+		client := NewClient(srv.URL, srv.Client())
+		client.Compression = Zstd
+
+		got, err := client.GetSize(payload)
+		if err != nil || got != len(payload) {
+			t.Fatalf("expected %d, got %d (%v)", len(payload), got, err)
+		}
+	})
+	t.Run("retried", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			fake := doertest.New(t)
+			fake.Respond(http.StatusServiceUnavailable, "busy")
+			fake.Respond(http.StatusOK, "1200")
+
+			client := NewClient("http://size.server", NewRetryDoer(fake, DefaultRetryPolicy()))
+			client.Compression = Gzip
+
+			if _, err := client.GetSize(payload); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			// Every attempt carries the full compressed payload.
+			bodies := fake.Bodies()
+			if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[0] == "" {
+				t.Fatalf("expected the same body twice, got %d bodies", len(bodies))
+			}
+		})
 	})
 }
@@ -1,7 +1,80 @@
 package client
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
 
 var (
 	ErrInvalidResponse = errors.New("invalid response body")
+	// ErrUnsupportedEncoding is returned for a Client.Compression the client cannot encode.
+	ErrUnsupportedEncoding = errors.New("unsupported encoding")
+	// ErrCircuitOpen is returned by CircuitBreaker while it rejects requests.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrClientError matches a *StatusError with a 4xx status code.
+	ErrClientError = errors.New("client error")
+	// ErrServerError matches a *StatusError with a 5xx status code.
+	ErrServerError = errors.New("server error")
 )
+
+// maxErrorBody limits how much of an error response body is kept in StatusError.
+const maxErrorBody = 512
+
+// StatusError is returned when the server responds with an unexpected status code.
+// Use errors.Is with ErrClientError or ErrServerError to check the class of the status code,
+// or errors.As to access the details.
+type StatusError struct {
+	StatusCode int
+	// Body holds the beginning of the response body, truncated to 512 bytes.
+	Body string
+	// Title and Detail are set when the body holds problem details (RFC 9457).
+	Title  string
+	Detail string
+}
+
+func (e *StatusError) Error() string {
+	message := e.Body
+	if e.Detail != "" {
+		message = e.Detail
+	}
+	if message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, message)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrClientError:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrServerError:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	default:
+		return false
+	}
+}
+
+// newStatusError creates a StatusError from a response, reading at most maxErrorBody bytes of its body.
+func newStatusError(response *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	err := &StatusError{
+		StatusCode: response.StatusCode,
+		Body:       string(body),
+	}
+	if hasMediaType(response, "application/problem+json") {
+		var problem struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		// A truncated or malformed problem still leaves the raw body in the error.
+		if json.Unmarshal(body, &problem) == nil {
+			err.Title = problem.Title
+			err.Detail = problem.Detail
+		}
+	}
+	return err
+}
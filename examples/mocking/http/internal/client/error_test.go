@@ -0,0 +1,68 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStatusError_Is(t *testing.T) {
+	cases := []struct {
+		status      int
+		clientError bool
+		serverError bool
+	}{
+		{http.StatusBadRequest, true, false},
+		{http.StatusNotFound, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusInternalServerError, false, true},
+		{http.StatusServiceUnavailable, false, true},
+		{http.StatusFound, false, false},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.status), func(t *testing.T) {
+			// Wrapping must not hide the class of the status code.
+			err := fmt.Errorf("get size: %w", &StatusError{StatusCode: c.status})
+
+			if got := errors.Is(err, ErrClientError); got != c.clientError {
+				t.Errorf("errors.Is(err, ErrClientError) = %t, want %t", got, c.clientError)
+			}
+			if got := errors.Is(err, ErrServerError); got != c.serverError {
+				t.Errorf("errors.Is(err, ErrServerError) = %t, want %t", got, c.serverError)
+			}
+		})
+	}
+}
+
+func TestNewStatusError(t *testing.T) {
+	t.Run("truncated", func(t *testing.T) {
+		response := &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader(strings.Repeat("x", 2*maxErrorBody))),
+		}
+
+		err := newStatusError(response)
+		if len(err.Body) != maxErrorBody {
+			t.Errorf("expected body of %d bytes, got %d", maxErrorBody, len(err.Body))
+		}
+	})
+	t.Run("message", func(t *testing.T) {
+		cases := map[string]struct {
+			err  *StatusError
+			want string
+		}{
+			"no_body":   {&StatusError{StatusCode: 500}, "unexpected status code: 500"},
+			"with_body": {&StatusError{StatusCode: 404, Body: "not found"}, "unexpected status code: 404: not found"},
+		}
+		for name, tt := range cases {
+			t.Run(name, func(t *testing.T) {
+				if got := tt.err.Error(); got != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// LimiterConfig configures a RateLimiter. Zero values are replaced with defaults.
+type LimiterConfig struct {
+	// Rate is the sustained number of requests per second. Zero or less disables the limit.
+	Rate float64
+	// Burst is the number of requests which may be sent at once after a quiet period. Defaults to 1.
+	Burst int
+	// Clock is used to refill the bucket and to wait for tokens. Defaults to the real clock.
+	Clock clockwork.Clock
+}
+
+// RateLimiter is a Doer decorator pacing requests with a token bucket. The bucket holds up to Burst tokens,
+// refills at Rate tokens per second and every request takes one, waiting for it when the bucket is empty.
+// Waiting respects the request context. It is safe for concurrent use.
+type RateLimiter struct {
+	next   Doer
+	config LimiterConfig
+
+	mu     sync.Mutex
+	tokens float64
+	// last is the time tokens was last brought up to date.
+	last time.Time
+}
+
+func NewRateLimiter(next Doer, config LimiterConfig) *RateLimiter {
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.Clock == nil {
+		config.Clock = clockwork.NewRealClock()
+	}
+	return &RateLimiter{
+		next:   next,
+		config: config,
+		// Starting with a full bucket.
+		tokens: float64(config.Burst),
+		last:   config.Clock.Now(),
+	}
+}
+
+func (l *RateLimiter) Do(r *http.Request) (*http.Response, error) {
+	if err := l.Wait(r.Context()); err != nil {
+		return nil, err
+	}
+	return l.next.Do(r)
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+// It fails right away when ctx has a deadline which comes before the token does.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l.config.Rate <= 0 {
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && l.config.Clock.Now().Add(delay).After(deadline) {
+		l.release()
+		return fmt.Errorf("rate limit wait of %v exceeds the deadline: %w", delay, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-l.config.Clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+// The bucket may go negative, which queues the callers in the order of their reservations.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.config.Rate * float64(time.Second))
+}
+
+// release returns the token of a caller which gave up waiting.
+func (l *RateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	l.tokens = min(l.tokens+1, float64(l.config.Burst))
+}
+
+// refill adds the tokens accumulated since the last update. Must be called with mu held.
+func (l *RateLimiter) refill() {
+	now := l.config.Clock.Now()
+	elapsed := now.Sub(l.last)
+	l.last = now
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens = min(l.tokens+elapsed.Seconds()*l.config.Rate, float64(l.config.Burst))
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"mocking_http/internal/doertest"
+)
+
+// okDoer responds 200 with the body "9" and records the time of every call.
+type okDoer struct {
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (d *okDoer) Do(r *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.calls = append(d.calls, time.Now())
+	d.mu.Unlock()
+	return (&stubDoer{results: []stubResult{{status: http.StatusOK}}}).Do(r)
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("burst_then_rate", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &okDoer{}
+			client := NewClient("http://size.server", NewRateLimiter(doer, LimiterConfig{Rate: 2, Burst: 3}))
+
+			start := time.Now()
+			for range 7 {
+				if _, err := client.GetSize([]byte("123456789")); err != nil {
+					t.Fatalf("expected no error, got `%s`", err.Error())
+				}
+			}
+
+			// 3 at once, then one every 500ms.
+			want := []time.Duration{0, 0, 0, 500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 2 * time.Second}
+			for i, call := range doer.calls {
+				if got := call.Sub(start); got != want[i] {
+					t.Errorf("call %d: expected at %v, got %v", i+1, want[i], got)
+				}
+			}
+		})
+	})
+	t.Run("refill", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &okDoer{}
+			limiter := NewRateLimiter(doer, LimiterConfig{Rate: 1, Burst: 2})
+
+			for range 2 {
+				limiter.Wait(t.Context())
+			}
+			// A quiet period refills the bucket, but never beyond the burst.
+			time.Sleep(10 * time.Second)
+
+			start := time.Now()
+			for range 3 {
+				limiter.Wait(t.Context())
+			}
+			if elapsed := time.Since(start); elapsed != time.Second {
+				t.Fatalf("expected the third request to wait 1s, got %v", elapsed)
+			}
+		})
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &okDoer{}
+			client := NewClient("http://size.server", NewRateLimiter(doer, LimiterConfig{Rate: 10}))
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Go(func() {
+					client.GetSize([]byte("123456789"))
+				})
+			}
+			wg.Wait()
+
+			if elapsed := time.Since(start); elapsed != 900*time.Millisecond {
+				t.Fatalf("expected 10 requests in 900ms, got %v", elapsed)
+			}
+		})
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			fake := doertest.New(t)
+			fake.Respond(http.StatusOK, "9").Times(2)
+			fake.ExpectCalls(2)
+			limiter := NewRateLimiter(fake, LimiterConfig{Rate: 1})
+			client := NewClient("http://size.server", limiter)
+
+			if _, err := client.GetSize([]byte("123456789")); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				cancel()
+			}()
+			start := time.Now()
+			if _, err := client.GetSizeContext(ctx, []byte("123456789")); !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected canceled, got `%v`", err)
+			}
+			if elapsed := time.Since(start); elapsed != 100*time.Millisecond {
+				t.Fatalf("expected to give up after 100ms, got %v", elapsed)
+			}
+
+			// The abandoned token is returned, so the next request waits for the first one only.
+			start = time.Now()
+			if _, err := client.GetSize([]byte("123456789")); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if elapsed := time.Since(start); elapsed != 900*time.Millisecond {
+				t.Fatalf("expected to wait 900ms, got %v", elapsed)
+			}
+		})
+	})
+	t.Run("deadline", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			limiter := NewRateLimiter(&okDoer{}, LimiterConfig{Rate: 1})
+			limiter.Wait(t.Context())
+
+			// The token comes after the deadline, so there is no point in waiting for it.
+			ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded, got `%v`", err)
+			}
+			if elapsed := time.Since(start); elapsed != 0 {
+				t.Fatalf("expected to fail right away, got %v", elapsed)
+			}
+
+			// A deadline after the token is fine.
+			ctx, cancel = context.WithTimeout(t.Context(), 2*time.Second)
+			defer cancel()
+			if err := limiter.Wait(ctx); err != nil {
+				t.Fatalf("expected no error, got `%v`", err)
+			}
+		})
+	})
+	t.Run("unlimited", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			limiter := NewRateLimiter(&okDoer{}, LimiterConfig{})
+
+			start := time.Now()
+			for range 100 {
+				if err := limiter.Wait(t.Context()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed != 0 {
+				t.Fatalf("expected no waiting, got %v", elapsed)
+			}
+		})
+	})
+	t.Run("fake_clock", func(t *testing.T) {
+		// The limiter works with any clockwork.Clock as well.
+		clock := clockwork.NewFakeClock()
+		limiter := NewRateLimiter(&okDoer{}, LimiterConfig{Rate: 1, Clock: clock})
+		limiter.Wait(t.Context())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- limiter.Wait(t.Context())
+		}()
+		clock.BlockUntilContext(t.Context(), 1)
+		select {
+		case <-done:
+			t.Fatal("expected to wait for a token")
+		default:
+		}
+
+		clock.Advance(time.Second)
+		if err := <-done; err != nil {
+			t.Fatalf("expected no error, got `%v`", err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is the number of concurrent requests of GetSizeMany when ManyOptions.Concurrency is not set.
+const DefaultConcurrency = 8
+
+// ManyOptions configures GetSizeMany.
+type ManyOptions struct {
+	// Concurrency is the maximum number of requests in flight. Zero or less means DefaultConcurrency.
+	Concurrency int
+}
+
+// SizeResult is the outcome of a single payload of GetSizeMany.
+type SizeResult struct {
+	Size int
+	Err  error
+}
+
+// GetSizeMany returns the sizes of payloads computed by the server, sending up to opts.Concurrency requests at once.
+// The results are in the order of payloads and every one carries its own error.
+// Once ctx is done no new request is started, the payloads which were not sent fail with the context error.
+func (c Client) GetSizeMany(ctx context.Context, payloads [][]byte, opts ManyOptions) []SizeResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	results := make([]SizeResult, len(payloads))
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for i, data := range payloads {
+		// Checking first, since select picks randomly when a slot is free as well.
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			results[i].Size, results[i].Err = c.GetSizeContext(ctx, data)
+		})
+	}
+	wg.Wait()
+	return results
+}
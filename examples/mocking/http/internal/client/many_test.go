@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// slowDoer responds with the size of the request body after a delay, tracking the number of requests in flight.
+type slowDoer struct {
+	// delay returns the time spent on a request with the given body.
+	delay func(body string) time.Duration
+
+	mu          sync.Mutex
+	calls       int
+	inFlight    int
+	maxInFlight int
+}
+
+func (d *slowDoer) Do(r *http.Request) (*http.Response, error) {
+	data, _ := io.ReadAll(r.Body)
+
+	d.mu.Lock()
+	d.calls++
+	d.inFlight++
+	d.maxInFlight = max(d.maxInFlight, d.inFlight)
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.inFlight--
+		d.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(d.delay(string(data))):
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(strconv.Itoa(len(data)))),
+	}, nil
+}
+
+// doerFunc adapts a function to Doer.
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// payloads returns n payloads, the i-th one being i bytes long.
+func payloads(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = []byte(strings.Repeat("x", i))
+	}
+	return out
+}
+
+func TestClient_GetSizeMany(t *testing.T) {
+	t.Run("bounded", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &slowDoer{delay: func(string) time.Duration { return time.Second }}
+			client := NewClient("http://size.server", doer)
+
+			start := time.Now()
+			results := client.GetSizeMany(t.Context(), payloads(10), ManyOptions{Concurrency: 3})
+
+			if doer.maxInFlight != 3 {
+				t.Errorf("expected 3 requests in flight, got %d", doer.maxInFlight)
+			}
+			// 10 requests of 1s, 3 at a time.
+			if elapsed := time.Since(start); elapsed != 4*time.Second {
+				t.Errorf("expected 4s, got %v", elapsed)
+			}
+			for i, result := range results {
+				if result.Err != nil || result.Size != i {
+					t.Errorf("result %d: expected %d, got %+v", i, i, result)
+				}
+			}
+		})
+	})
+	t.Run("order", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			// Longer payloads finish first.
+			doer := &slowDoer{delay: func(body string) time.Duration { return time.Duration(10-len(body)) * time.Second }}
+			client := NewClient("http://size.server", doer)
+
+			results := client.GetSizeMany(t.Context(), payloads(10), ManyOptions{Concurrency: 10})
+
+			for i, result := range results {
+				if result.Err != nil || result.Size != i {
+					t.Errorf("result %d: expected %d, got %+v", i, i, result)
+				}
+			}
+		})
+	})
+	t.Run("default_concurrency", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &slowDoer{delay: func(string) time.Duration { return time.Second }}
+			client := NewClient("http://size.server", doer)
+
+			client.GetSizeMany(t.Context(), payloads(20), ManyOptions{})
+
+			if doer.maxInFlight != DefaultConcurrency {
+				t.Errorf("expected %d requests in flight, got %d", DefaultConcurrency, doer.maxInFlight)
+			}
+		})
+	})
+	t.Run("per_item_errors", func(t *testing.T) {
+		fail := errors.New("boom")
+		doer := doerFunc(func(r *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(r.Body)
+			switch string(data) {
+			case "fail":
+				return nil, fail
+			case "bad":
+				return &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(strings.NewReader(""))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(strconv.Itoa(len(data))))}, nil
+		})
+		client := NewClient("http://size.server", doer)
+
+		results := client.GetSizeMany(t.Context(), [][]byte{[]byte("ok"), []byte("fail"), []byte("bad"), []byte("fine")}, ManyOptions{Concurrency: 2})
+
+		if results[0].Err != nil || results[0].Size != 2 {
+			t.Errorf("expected size 2, got %+v", results[0])
+		}
+		if !errors.Is(results[1].Err, fail) {
+			t.Errorf("expected %v, got %+v", fail, results[1])
+		}
+		if !errors.Is(results[2].Err, ErrClientError) {
+			t.Errorf("expected client error, got %+v", results[2])
+		}
+		if results[3].Err != nil || results[3].Size != 4 {
+			t.Errorf("expected size 4, got %+v", results[3])
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			doer := &slowDoer{delay: func(string) time.Duration { return time.Second }}
+			client := NewClient("http://size.server", doer)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 1500*time.Millisecond)
+			defer cancel()
+			results := client.GetSizeMany(ctx, payloads(6), ManyOptions{Concurrency: 2})
+
+			// The first two finish, the next two are cancelled in flight and the rest is never sent.
+			if doer.calls != 4 {
+				t.Errorf("expected 4 requests, got %d", doer.calls)
+			}
+			for i, result := range results {
+				if i < 2 {
+					if result.Err != nil || result.Size != i {
+						t.Errorf("result %d: expected %d, got %+v", i, i, result)
+					}
+					continue
+				}
+				if !errors.Is(result.Err, context.DeadlineExceeded) {
+					t.Errorf("result %d: expected deadline exceeded, got %+v", i, result)
+				}
+			}
+		})
+	})
+	t.Run("cancelled_before", func(t *testing.T) {
+		doer := &slowDoer{delay: func(string) time.Duration { return time.Second }}
+		client := NewClient("http://size.server", doer)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		results := client.GetSizeMany(ctx, payloads(3), ManyOptions{Concurrency: 3})
+
+		if doer.calls != 0 {
+			t.Errorf("expected no requests, got %d", doer.calls)
+		}
+		for i, result := range results {
+			if !errors.Is(result.Err, context.Canceled) {
+				t.Errorf("result %d: expected canceled, got %+v", i, result)
+			}
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		client := NewClient("http://size.server", &slowDoer{})
+		if results := client.GetSizeMany(t.Context(), nil, ManyOptions{}); len(results) != 0 {
+			t.Fatalf("expected no results, got %v", results)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// RetryPolicy configures how RetryDoer retries failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every following retry up to MaxDelay.
+	// Zero retries right away.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff and the wait requested by Retry-After. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay which is randomized, between 0 (no jitter) and 1 (full jitter).
+	Jitter float64
+	// RetryableStatus lists response status codes which are retried. Transport errors are always retried.
+	RetryableStatus []int
+	// Idempotent decides whether a request is safe to send more than once. Defaults to IsIdempotent.
+	Idempotent func(*http.Request) bool
+	// Clock is used to wait between attempts. Defaults to the real clock.
+	Clock clockwork.Clock
+}
+
+// DefaultRetryPolicy returns a policy retrying up to 3 times on transport errors and typical transient statuses.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.5,
+		RetryableStatus: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// IsIdempotent reports whether a request may be retried. Idempotent methods qualify, as do requests
+// with an Idempotency-Key header, following the same convention as http.Transport.
+// A request body must also be replayable through GetBody.
+func IsIdempotent(r *http.Request) bool {
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := r.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = r.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// RetryDoer is a Doer decorator retrying transient failures with exponential backoff.
+type RetryDoer struct {
+	next   Doer
+	policy RetryPolicy
+}
+
+func NewRetryDoer(next Doer, policy RetryPolicy) *RetryDoer {
+	if policy.Idempotent == nil {
+		policy.Idempotent = IsIdempotent
+	}
+	if policy.Clock == nil {
+		policy.Clock = clockwork.NewRealClock()
+	}
+	return &RetryDoer{
+		next:   next,
+		policy: policy,
+	}
+}
+
+// Do sends the request, retrying it while the policy allows. The response of the last attempt is returned,
+// even if its status is retryable. A Retry-After response header takes precedence over the computed backoff,
+// but it is still capped by MaxDelay, so a server cannot stall the caller for arbitrarily long.
+// Waiting between attempts is interrupted when the request context is done.
+func (d *RetryDoer) Do(r *http.Request) (*http.Response, error) {
+	attempts := d.policy.MaxAttempts
+	if attempts < 1 || !d.policy.Idempotent(r) {
+		attempts = 1
+	}
+
+	req := r
+	for attempt := 1; ; attempt++ {
+		response, err := d.next.Do(req)
+		if attempt >= attempts || !d.retryable(response, err) {
+			return response, err
+		}
+
+		delay := d.backoff(attempt)
+		if response != nil {
+			if retryAfter, ok := d.retryAfter(response); ok {
+				delay = retryAfter
+			}
+			// Draining the body allows the connection to be reused.
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		select {
+		case <-d.policy.Clock.After(delay):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+
+		if req, err = rewind(r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *RetryDoer) retryable(response *http.Response, err error) bool {
+	if err != nil {
+		// Cancelled requests must not be retried, transport errors (e.g. connection reset) can be.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return slices.Contains(d.policy.RetryableStatus, response.StatusCode)
+}
+
+// backoff returns the delay after the given attempt.
+func (d *RetryDoer) backoff(attempt int) time.Duration {
+	delay := d.policy.BaseDelay << (attempt - 1)
+	// Shifting back loses the bits which overflowed.
+	overflow := d.policy.BaseDelay > 0 && (delay <= 0 || delay>>(attempt-1) != d.policy.BaseDelay)
+	if overflow || (d.policy.MaxDelay > 0 && delay > d.policy.MaxDelay) {
+		delay = d.policy.MaxDelay
+	}
+	if d.policy.Jitter > 0 {
+		delay -= time.Duration(d.policy.Jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// retryAfter parses the Retry-After header, which holds either seconds or an HTTP date.
+// The delay is capped by MaxDelay.
+func (d *RetryDoer) retryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+		if delay/time.Second != time.Duration(seconds) {
+			// Overflowed, longer than any cap.
+			delay = math.MaxInt64
+		}
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = max(date.Sub(d.policy.Clock.Now()), 0)
+	} else {
+		return 0, false
+	}
+	if d.policy.MaxDelay > 0 {
+		delay = min(delay, d.policy.MaxDelay)
+	}
+	return delay, true
+}
+
+// rewind returns a copy of r with a fresh body, so it can be sent again.
+func rewind(r *http.Request) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
@@ -0,0 +1,361 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// stubDoer returns the scripted results in order and records request bodies.
+type stubDoer struct {
+	results []stubResult
+	bodies  []string
+}
+
+type stubResult struct {
+	status int
+	header http.Header
+	err    error
+}
+
+func (d *stubDoer) Do(r *http.Request) (*http.Response, error) {
+	body := ""
+	if r.Body != nil {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}
+	d.bodies = append(d.bodies, body)
+
+	result := d.results[0]
+	if len(d.results) > 1 {
+		d.results = d.results[1:]
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &http.Response{
+		StatusCode: result.status,
+		Header:     result.header,
+		Body:       io.NopCloser(strings.NewReader("9")),
+	}, nil
+}
+
+func testPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Second
+	policy.MaxDelay = 10 * time.Second
+	policy.Jitter = 0
+	return policy
+}
+
+func newRequest(t *testing.T, method string, body string) *http.Request {
+	request, err := http.NewRequestWithContext(t.Context(), method, "http://size.server", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestRetryDoer(t *testing.T) {
+	connReset := stubResult{err: syscall.ECONNRESET}
+	cases := map[string]struct {
+		results      []stubResult
+		method       string
+		wantStatus   int
+		wantErr      error
+		wantAttempts int
+		// wantElapsed is the total time spent waiting between attempts.
+		wantElapsed time.Duration
+	}{
+		"ok": {
+			results:      []stubResult{{status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 1,
+		},
+		"retry_5xx": {
+			results:      []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusBadGateway}, {status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+			wantElapsed:  3 * time.Second, // 1s + 2s
+		},
+		"retry_connection_reset": {
+			results:      []stubResult{connReset, {status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantElapsed:  time.Second,
+		},
+		"exhausted": {
+			results:      []stubResult{{status: http.StatusInternalServerError}},
+			wantStatus:   http.StatusInternalServerError,
+			wantAttempts: 4,
+			wantElapsed:  7 * time.Second, // 1s + 2s + 4s
+		},
+		"exhausted_error": {
+			results:      []stubResult{connReset},
+			wantErr:      syscall.ECONNRESET,
+			wantAttempts: 4,
+			wantElapsed:  7 * time.Second,
+		},
+		"not_retryable_status": {
+			results:      []stubResult{{status: http.StatusBadRequest}, {status: http.StatusOK}},
+			wantStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+		"not_idempotent": {
+			results:      []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}},
+			method:       http.MethodPost,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+		"retry_after_seconds": {
+			results:      []stubResult{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"5"}}}, {status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantElapsed:  5 * time.Second,
+		},
+		"retry_after_capped": {
+			// A server asking for a day is waited for MaxDelay only.
+			results:      []stubResult{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"86400"}}}, {status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantElapsed:  10 * time.Second,
+		},
+		"retry_after_overflow": {
+			results:      []stubResult{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"99999999999999999"}}}, {status: http.StatusOK}},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantElapsed:  10 * time.Second,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Inside the bubble the real clock uses fake time, so waiting between attempts is instant
+			// and the elapsed time is exact.
+			synctest.Test(t, func(t *testing.T) {
+				stub := &stubDoer{results: tt.results}
+				doer := NewRetryDoer(stub, testPolicy())
+
+				method := tt.method
+				if method == "" {
+					method = http.MethodGet
+				}
+				start := time.Now()
+				response, err := doer.Do(newRequest(t, method, "payload"))
+				elapsed := time.Since(start)
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if err == nil {
+					defer response.Body.Close()
+					if response.StatusCode != tt.wantStatus {
+						t.Errorf("expected status %d, got %d", tt.wantStatus, response.StatusCode)
+					}
+				}
+				if len(stub.bodies) != tt.wantAttempts {
+					t.Errorf("expected %d attempts, got %d", tt.wantAttempts, len(stub.bodies))
+				}
+				// Every attempt must send the full body again.
+				for i, body := range stub.bodies {
+					if body != "payload" {
+						t.Errorf("attempt %d: expected body `payload`, got `%s`", i+1, body)
+					}
+				}
+				if elapsed != tt.wantElapsed {
+					t.Errorf("expected %s elapsed, got %s", tt.wantElapsed, elapsed)
+				}
+			})
+		})
+	}
+}
+
+func TestRetryDoer_RetryAfterDate(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		retryAt := time.Now().Add(8 * time.Second).UTC().Format(http.TimeFormat)
+		stub := &stubDoer{results: []stubResult{
+			{status: http.StatusServiceUnavailable, header: http.Header{"Retry-After": {retryAt}}},
+			{status: http.StatusOK},
+		}}
+		doer := NewRetryDoer(stub, testPolicy())
+
+		start := time.Now()
+		response, err := doer.Do(newRequest(t, http.MethodGet, ""))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		response.Body.Close()
+
+		// HTTP dates have a second precision, so the wait may be up to a second shorter.
+		if elapsed := time.Since(start); elapsed > 8*time.Second || elapsed < 7*time.Second {
+			t.Errorf("expected ~8s elapsed, got %s", elapsed)
+		}
+	})
+}
+
+func TestRetryDoer_Idempotency(t *testing.T) {
+	t.Run("idempotency_key", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			stub := &stubDoer{results: []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}}}
+			doer := NewRetryDoer(stub, testPolicy())
+
+			request := newRequest(t, http.MethodPost, "payload")
+			request.Header.Set("Idempotency-Key", "abc")
+			response, err := doer.Do(request)
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			response.Body.Close()
+
+			if len(stub.bodies) != 2 {
+				t.Errorf("expected 2 attempts, got %d", len(stub.bodies))
+			}
+		})
+	})
+	t.Run("custom", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			stub := &stubDoer{results: []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}}}
+			policy := testPolicy()
+			policy.Idempotent = func(r *http.Request) bool { return false }
+			doer := NewRetryDoer(stub, policy)
+
+			response, err := doer.Do(newRequest(t, http.MethodGet, ""))
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			response.Body.Close()
+
+			if len(stub.bodies) != 1 {
+				t.Errorf("expected 1 attempt, got %d", len(stub.bodies))
+			}
+		})
+	})
+	t.Run("unreplayable_body", func(t *testing.T) {
+		request := newRequest(t, http.MethodGet, "")
+		request.Body = io.NopCloser(strings.NewReader("payload"))
+		request.GetBody = nil
+
+		if IsIdempotent(request) {
+			t.Error("expected request with an unreplayable body not to be idempotent")
+		}
+	})
+}
+
+func TestRetryDoer_Cancelled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		stub := &stubDoer{results: []stubResult{{status: http.StatusServiceUnavailable}}}
+		doer := NewRetryDoer(stub, testPolicy())
+
+		ctx, cancel := context.WithTimeout(t.Context(), 1500*time.Millisecond)
+		defer cancel()
+		request := newRequest(t, http.MethodGet, "").WithContext(ctx)
+
+		// The deadline expires while waiting for the second retry.
+		_, err := doer.Do(request)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got %v", err)
+		}
+		if len(stub.bodies) != 2 {
+			t.Errorf("expected 2 attempts, got %d", len(stub.bodies))
+		}
+	})
+}
+
+func TestRetryDoer_FakeClock(t *testing.T) {
+	// The same waits can be driven with a fake clock instead of synctest.
+	clock := clockwork.NewFakeClock()
+	stub := &stubDoer{results: []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}}}
+	policy := testPolicy()
+	policy.Clock = clock
+	doer := NewRetryDoer(stub, policy)
+
+	request := newRequest(t, http.MethodGet, "")
+	done := make(chan error)
+	go func() {
+		response, err := doer.Do(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		done <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if err := clock.BlockUntilContext(ctx, 1); err != nil {
+		t.Fatalf("expected retry to wait on the clock, got `%s`", err.Error())
+	}
+	clock.Advance(time.Second)
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got `%s`", err.Error())
+	}
+}
+
+func TestRetryDoer_RetryAfterDateCapped(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		retryAt := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+		stub := &stubDoer{results: []stubResult{
+			{status: http.StatusServiceUnavailable, header: http.Header{"Retry-After": {retryAt}}},
+			{status: http.StatusOK},
+		}}
+		doer := NewRetryDoer(stub, testPolicy())
+
+		start := time.Now()
+		response, err := doer.Do(newRequest(t, http.MethodGet, ""))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		response.Body.Close()
+
+		if elapsed := time.Since(start); elapsed != 10*time.Second {
+			t.Errorf("expected MaxDelay of 10s elapsed, got %s", elapsed)
+		}
+	})
+}
+
+func TestRetryDoer_NoDelay(t *testing.T) {
+	// A zero BaseDelay retries right away instead of waiting MaxDelay.
+	synctest.Test(t, func(t *testing.T) {
+		policy := testPolicy()
+		policy.BaseDelay = 0
+		stub := &stubDoer{results: []stubResult{{status: http.StatusServiceUnavailable}, {status: http.StatusServiceUnavailable}, {status: http.StatusOK}}}
+		doer := NewRetryDoer(stub, policy)
+
+		start := time.Now()
+		response, err := doer.Do(newRequest(t, http.MethodGet, ""))
+		if err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		response.Body.Close()
+
+		if elapsed := time.Since(start); elapsed != 0 {
+			t.Errorf("expected no waiting, got %s", elapsed)
+		}
+		if len(stub.bodies) != 3 {
+			t.Errorf("expected 3 attempts, got %d", len(stub.bodies))
+		}
+	})
+}
+
+func TestRetryDoer_Backoff(t *testing.T) {
+	policy := testPolicy()
+	policy.Jitter = 1
+	doer := NewRetryDoer(&stubDoer{}, policy)
+
+	// Attempt 35 shifts 1s to a positive but wrapped value, 100 shifts it to zero.
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 5: 10 * time.Second, 35: 10 * time.Second, 100: 10 * time.Second} {
+		for range 100 {
+			if got := doer.backoff(attempt); got < 0 || got > ceiling {
+				t.Fatalf("attempt %d: expected backoff in [0, %s], got %s", attempt, ceiling, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Package doertest provides a programmable fake Doer for client tests.
+//
+// Responses are queued upfront and served in order, one per call. Every request is recorded,
+// and the expectations are verified when the test finishes, similarly to a gomock controller,
+// but without generating code.
+package doertest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ErrUnexpectedCall is returned when a request arrives while no response is queued.
+var ErrUnexpectedCall = errors.New("doertest: unexpected call")
+
+// Fake is a Doer serving queued responses. It is safe for concurrent use.
+type Fake struct {
+	t testing.TB
+
+	mu       sync.Mutex
+	queue    []*Call
+	requests []*http.Request
+	bodies   []string
+	// expectedCalls is the number of calls verified at the end of the test, or -1 when not set.
+	expectedCalls int
+}
+
+// New returns an empty Fake verifying its expectations in t.Cleanup.
+func New(t testing.TB) *Fake {
+	f := &Fake{
+		t:             t,
+		expectedCalls: -1,
+	}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// Call is a queued response. Its methods return the Call for chaining.
+type Call struct {
+	status   int
+	header   http.Header
+	body     string
+	err      error
+	delay    time.Duration
+	times    int
+	wantBody *string
+}
+
+// Respond queues a response with the given status code and body.
+func (f *Fake) Respond(status int, body string) *Call {
+	return f.enqueue(&Call{status: status, header: http.Header{}, body: body, times: 1})
+}
+
+// Fail queues a transport error, e.g. syscall.ECONNRESET.
+func (f *Fake) Fail(err error) *Call {
+	return f.enqueue(&Call{err: err, header: http.Header{}, times: 1})
+}
+
+// Header sets a response header.
+func (c *Call) Header(key, value string) *Call {
+	c.header.Set(key, value)
+	return c
+}
+
+// Delay makes the call wait for d before responding. The wait is interrupted when the request context is done.
+func (c *Call) Delay(d time.Duration) *Call {
+	c.delay = d
+	return c
+}
+
+// Times serves the call n times in a row.
+func (c *Call) Times(n int) *Call {
+	c.times = n
+	return c
+}
+
+// ExpectBody fails the test if the request served by this call has a different body.
+func (c *Call) ExpectBody(body string) *Call {
+	c.wantBody = &body
+	return c
+}
+
+// ExpectCalls sets the exact number of calls the Fake must receive during the test.
+// Without it, the Fake only verifies that every queued response was used.
+func (f *Fake) ExpectCalls(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expectedCalls = n
+}
+
+// Requests returns the requests received so far. Their bodies were already consumed, see Bodies.
+func (f *Fake) Requests() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...)
+}
+
+// Bodies returns the bodies of the requests received so far.
+func (f *Fake) Bodies() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.bodies...)
+}
+
+func (f *Fake) Do(r *http.Request) (*http.Response, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+	call := f.next()
+	f.mu.Unlock()
+
+	if call == nil {
+		f.t.Errorf("doertest: unexpected call %s %s", r.Method, r.URL)
+		return nil, fmt.Errorf("%w: %s %s", ErrUnexpectedCall, r.Method, r.URL)
+	}
+	if call.wantBody != nil && *call.wantBody != body {
+		f.t.Errorf("doertest: %s %s: expected body `%s`, got `%s`", r.Method, r.URL, *call.wantBody, body)
+	}
+
+	if call.delay > 0 {
+		timer := time.NewTimer(call.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", call.status, http.StatusText(call.status)),
+		StatusCode:    call.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        call.header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(call.body)),
+		ContentLength: int64(len(call.body)),
+		Request:       r,
+	}, nil
+}
+
+func (f *Fake) enqueue(c *Call) *Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queue = append(f.queue, c)
+	return c
+}
+
+// next pops the call serving the current request. The caller must hold the lock.
+func (f *Fake) next() *Call {
+	for len(f.queue) > 0 && f.queue[0].times <= 0 {
+		f.queue = f.queue[1:]
+	}
+	if len(f.queue) == 0 {
+		return nil
+	}
+	call := f.queue[0]
+	call.times--
+	return call
+}
+
+func (f *Fake) verify() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.expectedCalls >= 0 {
+		if len(f.requests) != f.expectedCalls {
+			f.t.Errorf("doertest: expected %d calls, got %d", f.expectedCalls, len(f.requests))
+		}
+		return
+	}
+	remaining := 0
+	for _, call := range f.queue {
+		remaining += max(call.times, 0)
+	}
+	if remaining > 0 {
+		f.t.Errorf("doertest: %d queued responses were not used", remaining)
+	}
+}
+
+func readBody(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
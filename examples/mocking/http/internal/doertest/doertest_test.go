@@ -0,0 +1,174 @@
+package doertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// fakeTB captures errors reported by the Fake, so failed expectations can be asserted.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) finish() {
+	for _, fn := range f.cleanups {
+		fn()
+	}
+}
+
+func send(t *testing.T, ctx context.Context, fake *Fake, body string) (string, int, error) {
+	t.Helper()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://size.server/", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := fake.Do(request)
+	if err != nil {
+		return "", 0, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), response.StatusCode, nil
+}
+
+func TestFake(t *testing.T) {
+	t.Run("queued_responses", func(t *testing.T) {
+		fake := New(t)
+		fake.Respond(http.StatusServiceUnavailable, "busy").Times(2)
+		fake.Respond(http.StatusOK, "3").Header("X-Test", "1").ExpectBody("abc")
+
+		for _, want := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK} {
+			_, status, err := send(t, t.Context(), fake, "abc")
+			if err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if status != want {
+				t.Errorf("expected status %d, got %d", want, status)
+			}
+		}
+
+		if got := fake.Requests()[2].Method; got != http.MethodPost {
+			t.Errorf("expected method POST, got %s", got)
+		}
+		if got := len(fake.Bodies()); got != 3 {
+			t.Errorf("expected 3 recorded bodies, got %d", got)
+		}
+	})
+	t.Run("transport_error", func(t *testing.T) {
+		fake := New(t)
+		// Header is harmless on a failing call, so calls can be built uniformly.
+		fake.Fail(syscall.ECONNRESET).Header("X-Test", "1")
+
+		if _, _, err := send(t, t.Context(), fake, ""); !errors.Is(err, syscall.ECONNRESET) {
+			t.Fatalf("expected connection reset, got %v", err)
+		}
+	})
+	t.Run("delay", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			fake := New(t)
+			fake.Respond(http.StatusOK, "0").Delay(time.Second)
+
+			start := time.Now()
+			if _, _, err := send(t, t.Context(), fake, ""); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if elapsed := time.Since(start); elapsed != time.Second {
+				t.Errorf("expected 1s elapsed, got %s", elapsed)
+			}
+		})
+	})
+	t.Run("delay_cancelled", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			fake := New(t)
+			fake.Respond(http.StatusOK, "0").Delay(time.Minute)
+
+			ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+			defer cancel()
+			if _, _, err := send(t, ctx, fake, ""); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded, got %v", err)
+			}
+		})
+	})
+}
+
+func TestFake_Verify(t *testing.T) {
+	cases := map[string]struct {
+		setup      func(f *Fake)
+		calls      int
+		wantErrors int
+	}{
+		"all_used": {
+			setup:      func(f *Fake) { f.Respond(http.StatusOK, "0").Times(2) },
+			calls:      2,
+			wantErrors: 0,
+		},
+		"unused_response": {
+			setup:      func(f *Fake) { f.Respond(http.StatusOK, "0").Times(2) },
+			calls:      1,
+			wantErrors: 1,
+		},
+		"unexpected_call": {
+			setup:      func(f *Fake) { f.Respond(http.StatusOK, "0") },
+			calls:      2,
+			wantErrors: 1,
+		},
+		"wrong_body": {
+			setup:      func(f *Fake) { f.Respond(http.StatusOK, "0").ExpectBody("other") },
+			calls:      1,
+			wantErrors: 1,
+		},
+		"expect_calls": {
+			setup: func(f *Fake) {
+				f.Respond(http.StatusOK, "0").Times(5)
+				f.ExpectCalls(3)
+			},
+			calls:      3,
+			wantErrors: 0,
+		},
+		"expect_calls_mismatch": {
+			setup: func(f *Fake) {
+				f.Respond(http.StatusOK, "0").Times(5)
+				f.ExpectCalls(3)
+			},
+			calls:      2,
+			wantErrors: 1,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			tb := &fakeTB{TB: t}
+			fake := New(tb)
+			tt.setup(fake)
+
+			for range tt.calls {
+				send(t, t.Context(), fake, "body")
+			}
+			tb.finish()
+
+			if len(tb.errors) != tt.wantErrors {
+				t.Errorf("expected %d test errors, got %d: %v", tt.wantErrors, len(tb.errors), tb.errors)
+			}
+		})
+	}
+}
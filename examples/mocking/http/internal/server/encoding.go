@@ -0,0 +1,102 @@
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressedSizeHeader is the response header of the size endpoint holding the size of an encoded request body
+// as received, while the response itself holds the decoded size.
+const CompressedSizeHeader = "X-Compressed-Size"
+
+// decoders lists the supported request Content-Encodings.
+var decoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	// HTTP deflate is the zlib format rather than raw deflate.
+	"deflate": func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) },
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		// Decoding synchronously as the body is a stream, and capping the window at the 8MB
+		// required by RFC 9659, so a small body cannot make us allocate a huge history buffer.
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+// zstdMaxWindow is the largest zstd window accepted in HTTP, see RFC 9659.
+const zstdMaxWindow = 8 << 20
+
+// acceptedEncodings is the value of the Accept-Encoding header of a 415 response.
+var acceptedEncodings = strings.Join(slices.Sorted(maps.Keys(decoders)), ", ")
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errMalformedBody       = errors.New("malformed encoded body")
+)
+
+// requestBody is a request body decoded according to its Content-Encoding.
+type requestBody struct {
+	io.ReadCloser
+	// wire counts the bytes of the body as received.
+	wire *countingReader
+	// encoded is set when the body was decoded.
+	encoded bool
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeError marks errors of a decoder reporting a malformed body with errMalformedBody.
+// Errors of the underlying body, such as exceeding the size limit, are passed through.
+type decodeError struct {
+	io.ReadCloser
+}
+
+func (d decodeError) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if malformed(err) {
+		err = errors.Join(errMalformedBody, err)
+	}
+	return n, err
+}
+
+// malformed reports whether err comes from decoding an invalid stream.
+func malformed(err error) bool {
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, zlib.ErrHeader) || errors.Is(err, zlib.ErrChecksum) || errors.Is(err, zlib.ErrDictionary) ||
+		errors.As(err, &corrupt) || malformedZstd(err)
+}
+
+// malformedZstd reports whether err comes from decoding an invalid zstd stream.
+func malformedZstd(err error) bool {
+	for _, target := range []error{
+		zstd.ErrMagicMismatch, zstd.ErrReservedBlockType, zstd.ErrCompressedSizeTooBig, zstd.ErrBlockTooSmall,
+		zstd.ErrUnexpectedBlockSize, zstd.ErrWindowSizeExceeded, zstd.ErrWindowSizeTooSmall, zstd.ErrUnknownDictionary,
+		zstd.ErrFrameSizeExceeded, zstd.ErrFrameSizeMismatch, zstd.ErrCRCMismatch,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with middlewares. The first middleware is the outermost one, so it sees the request first.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusWriter records the status code and the number of bytes written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging logs every request with its outcome to logger, or to slog.Default when logger is nil.
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			if sw.status == 0 {
+				// Nothing was written, net/http responds with 200.
+				sw.status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sw.status),
+				slog.Int64("bytes", sw.bytes),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if id := RequestIDFrom(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		})
+	}
+}
+
+// RequestIDHeader is the header carrying the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestID limits the length of a request ID accepted from a client.
+const maxRequestID = 128
+
+type requestIDKey struct{}
+
+// RequestID propagates the X-Request-ID header of the request, or a new random ID when it is missing or invalid.
+// The ID is echoed in the response and available to the following handlers through RequestIDFrom.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the request ID stored in ctx by RequestID, or an empty string.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether id is short and made of printable ASCII only, so it is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Recover turns a panic in the handler into a 500 response and logs it with the stack trace to logger,
+// or to slog.Default when logger is nil.
+// A panic with http.ErrAbortHandler is passed through, since it is the way to abort a response on purpose.
+func Recover(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				logger.ErrorContext(r.Context(), "handler panicked",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("panic", fmt.Sprint(v)),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if sw.status != 0 {
+					// The response has already started, aborting the connection is all that is left.
+					panic(http.ErrAbortHandler)
+				}
+				writeProblem(w, http.StatusInternalServerError, "internal error")
+			}()
+
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// Timeout limits the time spent on a request to d, like http.TimeoutHandler. The response of the handler
+// is buffered and sent once it returns. When it does not return within d, the client gets 503 instead and
+// later writes of the handler fail with http.ErrHandlerTimeout. The request context is cancelled after d
+// and reading the body fails afterwards, so handlers can give up early.
+//
+// As the response is buffered, the handler cannot flush or stream it.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			// Unblocking a read from a stalled client. Not every ResponseWriter supports deadlines,
+			// the context check in contextReader still applies to them.
+			_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(d))
+
+			r = r.WithContext(ctx)
+			r.Body = &contextReader{ctx: ctx, ReadCloser: r.Body}
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						if v != http.ErrAbortHandler {
+							// Keeping the stack of the handler, which is lost when panicking again below.
+							v = fmt.Sprintf("%v\n\n%s", v, debug.Stack())
+						}
+						panicked <- v
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case v := <-panicked:
+				panic(v)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				maps.Copy(w.Header(), tw.header)
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				detail := "request timed out"
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					detail = "request cancelled"
+				}
+				writeProblem(w, http.StatusServiceUnavailable, detail)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout.
+type timeoutWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// timedOut is set once Timeout responded on its own, the response is discarded from then on.
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
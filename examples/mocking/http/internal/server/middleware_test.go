@@ -0,0 +1,419 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// newTestLogger returns a logger writing JSON records to the returned buffer.
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, nil)), &buf
+}
+
+// records decodes the JSON records written by a logger from newTestLogger.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), tag("first"), tag("second"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := strings.Join(order, ","); got != "first,second,handler" {
+		t.Fatalf("expected first,second,handler, got `%s`", got)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	cases := map[string]struct {
+		handler    http.HandlerFunc
+		wantStatus float64
+		wantBytes  float64
+	}{
+		"ok": {
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) },
+			wantStatus: http.StatusOK,
+			wantBytes:  5,
+		},
+		"status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.WriteHeader(http.StatusOK) // superfluous, ignored by net/http as well
+			},
+			wantStatus: http.StatusTeapot,
+		},
+		"empty": {
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			logger, buf := newTestLogger()
+			handler := Logging(logger)(tt.handler)
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/stats", nil))
+
+			logged := records(t, buf)
+			if len(logged) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(logged))
+			}
+			record := logged[0]
+			if record["msg"] != "request" || record["method"] != http.MethodPost || record["path"] != "/stats" {
+				t.Errorf("unexpected record %v", record)
+			}
+			if record["status"] != tt.wantStatus || record["bytes"] != tt.wantBytes {
+				t.Errorf("expected status %v with %v bytes, got %v", tt.wantStatus, tt.wantBytes, record)
+			}
+			if _, ok := record["duration"]; !ok {
+				t.Errorf("expected duration in %v", record)
+			}
+			if _, ok := record["request_id"]; ok {
+				t.Errorf("expected no request_id without RequestID, got %v", record)
+			}
+		})
+	}
+	t.Run("request_id", func(t *testing.T) {
+		logger, buf := newTestLogger()
+		handler := Chain(&Server{}, RequestID, Logging(logger))
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("123"))
+		request.Header.Set(RequestIDHeader, "abc-123")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		if record := records(t, buf)[0]; record["request_id"] != "abc-123" {
+			t.Fatalf("expected request_id abc-123, got %v", record)
+		}
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	cases := map[string]struct {
+		header   string
+		generate bool
+	}{
+		"propagated":    {header: "abc-123"},
+		"missing":       {generate: true},
+		"too_long":      {header: strings.Repeat("a", maxRequestID+1), generate: true},
+		"non_printable": {header: "abc\x00def", generate: true},
+		"spaces":        {header: "abc def", generate: true},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestIDFrom(r.Context())
+			}))
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header != "" {
+				request.Header.Set(RequestIDHeader, tt.header)
+			}
+			handler.ServeHTTP(responseRecorder, request)
+
+			got := responseRecorder.Header().Get(RequestIDHeader)
+			if got != seen {
+				t.Fatalf("expected the response to echo `%s`, got `%s`", seen, got)
+			}
+			if tt.generate {
+				if got == "" || got == tt.header || !validRequestID(got) {
+					t.Fatalf("expected a new valid request ID, got `%s`", got)
+				}
+			} else if got != tt.header {
+				t.Fatalf("expected `%s`, got `%s`", tt.header, got)
+			}
+		})
+	}
+	t.Run("unique", func(t *testing.T) {
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		seen := make(map[string]bool)
+		for range 100 {
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+			id := responseRecorder.Header().Get(RequestIDHeader)
+			if seen[id] {
+				t.Fatalf("request ID `%s` generated twice", id)
+			}
+			seen[id] = true
+		}
+	})
+	t.Run("outside_chain", func(t *testing.T) {
+		if id := RequestIDFrom(t.Context()); id != "" {
+			t.Fatalf("expected no request ID, got `%s`", id)
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	t.Run("panic", func(t *testing.T) {
+		logger, buf := newTestLogger()
+		handler := Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		if responseRecorder.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got `%d`", responseRecorder.Code)
+		}
+		if got := responseRecorder.Header().Get("Content-Type"); got != contentTypeProblem {
+			t.Fatalf("expected %s, got `%s`", contentTypeProblem, got)
+		}
+		record := records(t, buf)[0]
+		if record["level"] != "ERROR" || record["panic"] != "boom" {
+			t.Fatalf("unexpected record %v", record)
+		}
+		// The stack trace points at the panicking handler.
+		if stack, _ := record["stack"].(string); !strings.Contains(stack, "TestRecover") {
+			t.Fatalf("expected stack trace, got `%s`", stack)
+		}
+	})
+	t.Run("no_panic", func(t *testing.T) {
+		logger, buf := newTestLogger()
+		handler := Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		if responseRecorder.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got `%d`", responseRecorder.Code)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("expected nothing logged, got `%s`", buf.String())
+		}
+	})
+	t.Run("started_response", func(t *testing.T) {
+		// The status is already sent, so the connection is aborted instead.
+		logger, _ := newTestLogger()
+		handler := Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic("boom")
+		}))
+
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler, got %v", v)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	})
+	t.Run("abort_handler", func(t *testing.T) {
+		logger, buf := newTestLogger()
+		handler := Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler, got %v", v)
+			}
+			if buf.Len() != 0 {
+				t.Fatalf("expected nothing logged, got `%s`", buf.String())
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	})
+	t.Run("server", func(t *testing.T) {
+		// Behind a real server the client receives the 500.
+		logger, _ := newTestLogger()
+		srv := httptest.NewServer(Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var m map[string]int
+			m["boom"]++
+		})))
+		defer srv.Close()
+
+		response, err := srv.Client().Post(srv.URL, "text/plain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got `%d`", response.StatusCode)
+		}
+	})
+}
+
+// slowReader returns one byte every delay.
+type slowReader struct {
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = 'x'
+	return 1, nil
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("within", func(t *testing.T) {
+		handler := Timeout(time.Second)(&Server{})
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("123")))
+
+		if responseRecorder.Code != http.StatusOK || responseRecorder.Body.String() != "3" {
+			t.Fatalf("expected 200 with `3`, got `%d` with `%s`", responseRecorder.Code, responseRecorder.Body.String())
+		}
+	})
+	t.Run("context", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			deadlines := make(chan time.Time, 1)
+			handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, _ := r.Context().Deadline()
+				deadlines <- deadline
+				<-r.Context().Done()
+			}))
+
+			start := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+			if want, deadline := start.Add(time.Second), <-deadlines; !deadline.Equal(want) {
+				t.Fatalf("expected deadline %v, got %v", want, deadline)
+			}
+			if elapsed := time.Since(start); elapsed != time.Second {
+				t.Fatalf("expected the handler to be cancelled after 1s, got %v", elapsed)
+			}
+		})
+	})
+	t.Run("slow_body", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			done := make(chan struct{})
+			handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(done)
+				(&Server{}).ServeHTTP(w, r)
+			}))
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(&slowReader{delay: 100 * time.Millisecond}))
+			handler.ServeHTTP(responseRecorder, request)
+			// The handler may still be in a read, which fails once it returns.
+			<-done
+
+			if responseRecorder.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got `%d`", responseRecorder.Code)
+			}
+			if got := responseRecorder.Header().Get("Content-Type"); got != contentTypeProblem {
+				t.Fatalf("expected %s, got `%s`", contentTypeProblem, got)
+			}
+		})
+	})
+	t.Run("slow_handler", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			// The handler ignores the context, the client gets 503 at the deadline anyway.
+			writeErr := make(chan error, 1)
+			handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Partial", "1")
+				time.Sleep(2 * time.Second)
+				_, err := io.WriteString(w, "too late")
+				writeErr <- err
+			}))
+
+			responseRecorder := httptest.NewRecorder()
+			start := time.Now()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+			if elapsed := time.Since(start); elapsed != time.Second {
+				t.Fatalf("expected to respond after 1s, got %v", elapsed)
+			}
+			if responseRecorder.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got `%d`", responseRecorder.Code)
+			}
+			if got := responseRecorder.Header().Get("Content-Type"); got != contentTypeProblem {
+				t.Fatalf("expected %s, got `%s`", contentTypeProblem, got)
+			}
+			if got := responseRecorder.Header().Get("X-Partial"); got != "" {
+				t.Fatalf("expected the headers of the handler to be discarded, got `%s`", got)
+			}
+			if err := <-writeErr; !errors.Is(err, http.ErrHandlerTimeout) {
+				t.Fatalf("expected %v, got `%v`", http.ErrHandlerTimeout, err)
+			}
+		})
+	})
+	t.Run("buffered", func(t *testing.T) {
+		handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "1")
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, "done")
+		}))
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		if responseRecorder.Code != http.StatusAccepted || responseRecorder.Body.String() != "done" {
+			t.Fatalf("expected 202 with `done`, got `%d` with `%s`", responseRecorder.Code, responseRecorder.Body.String())
+		}
+		if got := responseRecorder.Header().Get("X-Test"); got != "1" {
+			t.Fatalf("expected X-Test header, got `%s`", got)
+		}
+	})
+	t.Run("panic", func(t *testing.T) {
+		// A panic of the handler reaches the middlewares outside of Timeout.
+		logger, _ := newTestLogger()
+		handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}), Recover(logger), Timeout(time.Second))
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		if responseRecorder.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got `%d`", responseRecorder.Code)
+		}
+	})
+	t.Run("server", func(t *testing.T) {
+		// A client stalling in the middle of the body is cut off by the read deadline.
+		srv := httptest.NewServer(Timeout(100 * time.Millisecond)(&Server{}))
+		defer srv.Close()
+
+		reader, writer := io.Pipe()
+		defer writer.Close()
+		go writer.Write([]byte("123"))
+
+		response, err := srv.Client().Post(srv.URL, "text/plain", reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got `%d`", response.StatusCode)
+		}
+	})
+}
@@ -1,18 +1,303 @@
 package server
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
-// Server implements a very simple server which returns the size of request body in bytes.
-type Server struct{}
+// Server implements a small content-analysis server. Every endpoint accepts only POST and analyses the request body:
+//
+//	/                  returns the size of the body in bytes
+//	/hash/{algorithm}  returns the hex encoded sha256, md5 or crc32 checksum
+//	/stats             returns byte, rune, line and word counts as JSON
+//	/mime              returns the detected MIME type
+//
+// Responses are plain text unless the client sends `Accept: application/json`.
+// Errors are always reported as JSON problem details.
+// Request bodies are processed as streams and limited to MaxBodySize bytes.
+// They may be compressed with gzip, deflate or zstd as declared by Content-Encoding, other encodings are rejected with 415
+// listing the supported ones in Accept-Encoding.
+// The limit applies to both the encoded and the decoded body.
+// The zero value is ready to use.
+type Server struct {
+	// MaxBodySize is the maximum accepted request body size. Larger bodies are rejected with 413.
+	// Zero means DefaultMaxBodySize and a negative value disables the limit.
+	MaxBodySize int64
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// DefaultMaxBodySize is the body size limit of a Server without MaxBodySize set.
+const DefaultMaxBodySize = 10 << 20
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	reqBody, _ := io.ReadAll(r.Body)
-	defer r.Body.Close()
+	s.once.Do(s.routes)
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/{$}", allow(http.MethodPost, s.size))
+	s.mux.HandleFunc("/hash/{algorithm}", allow(http.MethodPost, s.hash))
+	s.mux.HandleFunc("/stats", allow(http.MethodPost, s.stats))
+	s.mux.HandleFunc("/mime", allow(http.MethodPost, s.mime))
+	s.mux.HandleFunc("/", notFound)
+}
+
+// body returns the request body decoded according to its Content-Encoding and limited to MaxBodySize.
+func (s *Server) body(w http.ResponseWriter, r *http.Request) (*requestBody, error) {
+	limit := s.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+	// limited applies the size limit to rc.
+	limited := func(rc io.ReadCloser) io.ReadCloser {
+		if limit < 0 {
+			return rc
+		}
+		return http.MaxBytesReader(w, rc, limit)
+	}
+
+	body := &requestBody{wire: &countingReader{r: limited(r.Body)}}
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		body.ReadCloser = io.NopCloser(body.wire)
+		return body, nil
+	}
+
+	newDecoder, ok := decoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+	decoder, err := newDecoder(body.wire)
+	if err != nil {
+		// An empty body has no header either.
+		if malformed(err) || errors.Is(err, io.EOF) {
+			err = errors.Join(errMalformedBody, err)
+		}
+		return nil, err
+	}
+	// Limiting the decoded body as well, a small encoded body can expand enormously.
+	body.ReadCloser = limited(decodeError{decoder})
+	body.encoded = true
+	return body, nil
+}
+
+// readError responds to an error returned while reading the request body.
+func readError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		writeProblem(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit))
+	case errors.Is(err, errUnsupportedEncoding):
+		w.Header().Set("Accept-Encoding", acceptedEncodings)
+		writeProblem(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, errMalformedBody):
+		writeProblem(w, http.StatusBadRequest, "malformed encoded request body")
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		// The request ran out of time, see Timeout.
+		writeProblem(w, http.StatusServiceUnavailable, "request timed out")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// The client sent less data than it announced.
+		writeProblem(w, http.StatusBadRequest, "truncated request body")
+	default:
+		writeProblem(w, http.StatusInternalServerError, "reading request body")
+	}
+}
+
+type sizeResponse struct {
+	Size int64 `json:"size"`
+}
+
+func (s *Server) size(w http.ResponseWriter, r *http.Request) {
+	body, err := s.body(w, r)
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	defer body.Close()
+
+	// Counting the bytes while streaming, so the body is never held in memory.
+	size, err := io.Copy(io.Discard, body)
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	if body.encoded {
+		// The decoder may stop before the end of the encoded body, which still counts.
+		if _, err := io.Copy(io.Discard, body.wire); err != nil {
+			readError(w, err)
+			return
+		}
+		w.Header().Set(CompressedSizeHeader, strconv.FormatInt(body.wire.n, 10))
+	}
+
+	writeText(w, r, strconv.FormatInt(size, 10), sizeResponse{Size: size})
+}
+
+// hashes lists the supported checksum algorithms.
+var hashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+type hashResponse struct {
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
+func (s *Server) hash(w http.ResponseWriter, r *http.Request) {
+	newHash, ok := hashes[r.PathValue("algorithm")]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "unsupported hash algorithm "+r.PathValue("algorithm"))
+		return
+	}
+	body, err := s.body(w, r)
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	defer body.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, body); err != nil {
+		readError(w, err)
+		return
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	writeText(w, r, sum, hashResponse{Algorithm: r.PathValue("algorithm"), Hash: sum})
+}
+
+// Stats holds the content statistics returned by the /stats endpoint.
+type Stats struct {
+	Bytes int `json:"bytes"`
+	Runes int `json:"runes"`
+	// Lines counts newline separated lines, including a last line without a trailing newline.
+	Lines int `json:"lines"`
+	Words int `json:"words"`
+}
+
+// ContentStats computes Stats of data.
+func ContentStats(data []byte) Stats {
+	var c statsCounter
+	c.Write(data)
+	return c.Stats()
+}
+
+// statsCounter is an io.Writer computing Stats of everything written to it,
+// so the statistics of a stream can be computed chunk by chunk.
+type statsCounter struct {
+	stats  Stats
+	inWord bool
+	last   byte
+	// partial holds the beginning of a rune split between two writes.
+	partial []byte
+}
+
+func (c *statsCounter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c.stats.Bytes += len(p)
+	c.last = p[len(p)-1]
+
+	data := p
+	if len(c.partial) > 0 {
+		data = append(c.partial, p...)
+		c.partial = nil
+	}
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			c.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		c.rune(r)
+		data = data[size:]
+	}
+	return len(p), nil
+}
+
+func (c *statsCounter) rune(r rune) {
+	c.stats.Runes++
+	if r == '\n' {
+		c.stats.Lines++
+	}
+	if unicode.IsSpace(r) {
+		c.inWord = false
+	} else if !c.inWord {
+		c.inWord = true
+		c.stats.Words++
+	}
+}
+
+// Stats returns the statistics of the data written so far.
+func (c *statsCounter) Stats() Stats {
+	stats := c.stats
+	// An incomplete rune at the end is invalid UTF-8, every byte of it counts as a separate rune.
+	stats.Runes += len(c.partial)
+	if len(c.partial) > 0 && !c.inWord {
+		stats.Words++
+	}
+	if stats.Bytes > 0 && c.last != '\n' {
+		stats.Lines++
+	}
+	return stats
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	body, err := s.body(w, r)
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	defer body.Close()
+
+	var counter statsCounter
+	if _, err := io.Copy(&counter, body); err != nil {
+		readError(w, err)
+		return
+	}
+
+	writeJSON(w, counter.Stats())
+}
+
+type mimeResponse struct {
+	MIME string `json:"mime"`
+}
+
+func (s *Server) mime(w http.ResponseWriter, r *http.Request) {
+	body, err := s.body(w, r)
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	defer body.Close()
+
+	// DetectContentType considers at most the first 512 bytes.
+	head, err := io.ReadAll(io.LimitReader(body, 512))
+	if err != nil {
+		readError(w, err)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(strconv.Itoa(len(reqBody))))
+	mimeType := http.DetectContentType(head)
+	writeText(w, r, mimeType, mimeResponse{MIME: mimeType})
 }
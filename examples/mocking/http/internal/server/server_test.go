@@ -2,9 +2,19 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestServer(t *testing.T) {
@@ -13,7 +23,7 @@ func TestServer(t *testing.T) {
 		requestBody := []byte("123")
 
 		responseRecorder := httptest.NewRecorder()
-		request := httptest.NewRequest(http.MethodGet, "/", bytes.NewReader(requestBody))
+		request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(requestBody))
 
 		srv.ServeHTTP(responseRecorder, request)
 
@@ -25,3 +35,398 @@ func TestServer(t *testing.T) {
 		}
 	})
 }
+
+func TestServer_Hash(t *testing.T) {
+	cases := map[string]struct {
+		algorithm string
+		wantCode  int
+		wantBody  string
+	}{
+		"sha256":      {algorithm: "sha256", wantCode: http.StatusOK, wantBody: "a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3"},
+		"md5":         {algorithm: "md5", wantCode: http.StatusOK, wantBody: "202cb962ac59075b964b07152d234b70"},
+		"crc32":       {algorithm: "crc32", wantCode: http.StatusOK, wantBody: "884863d2"},
+		"unsupported": {algorithm: "sha1", wantCode: http.StatusNotFound},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/hash/"+tt.algorithm, bytes.NewReader([]byte("123")))
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != tt.wantCode {
+				t.Fatalf("expected %d, got `%d`", tt.wantCode, responseRecorder.Code)
+			}
+			if tt.wantBody != "" && responseRecorder.Body.String() != tt.wantBody {
+				t.Fatalf("expected `%s`, got `%s`", tt.wantBody, responseRecorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_Stats(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want Stats
+	}{
+		"empty":            {body: "", want: Stats{}},
+		"single_line":      {body: "hello world", want: Stats{Bytes: 11, Runes: 11, Lines: 1, Words: 2}},
+		"trailing_newline": {body: "a b\nc\n", want: Stats{Bytes: 6, Runes: 6, Lines: 2, Words: 3}},
+		"no_trailing_line": {body: "a\n\nb", want: Stats{Bytes: 4, Runes: 4, Lines: 3, Words: 2}},
+		"multi_byte_runes": {body: "zażółć gęślą", want: Stats{Bytes: 19, Runes: 12, Lines: 1, Words: 2}},
+		"whitespace_only":  {body: " \t\n", want: Stats{Bytes: 3, Runes: 3, Lines: 1, Words: 0}},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/stats", bytes.NewReader([]byte(tt.body)))
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got `%d`", responseRecorder.Code)
+			}
+			if got := responseRecorder.Header().Get("Content-Type"); got != "application/json" {
+				t.Fatalf("expected application/json, got `%s`", got)
+			}
+			var got Stats
+			if err := json.NewDecoder(responseRecorder.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServer_MIME(t *testing.T) {
+	cases := map[string]struct {
+		body []byte
+		want string
+	}{
+		"text": {body: []byte("hello"), want: "text/plain; charset=utf-8"},
+		"html": {body: []byte("<!DOCTYPE html><html></html>"), want: "text/html; charset=utf-8"},
+		"png":  {body: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), want: "image/png"},
+		"json": {body: []byte(`{"a":1}`), want: "text/plain; charset=utf-8"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/mime", bytes.NewReader(tt.body))
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got `%d`", responseRecorder.Code)
+			}
+			if responseRecorder.Body.String() != tt.want {
+				t.Fatalf("expected `%s`, got `%s`", tt.want, responseRecorder.Body.String())
+			}
+		})
+	}
+}
+
+// failingReader returns data and then fails with err.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestServer_Body(t *testing.T) {
+	paths := []string{"/", "/hash/sha256", "/stats", "/mime"}
+	cases := map[string]struct {
+		maxBodySize int64
+		// body returns a fresh reader for every request, a shared one would be drained by the first.
+		body     func() io.Reader
+		wantCode int
+	}{
+		"within_limit": {maxBodySize: 10, body: func() io.Reader { return bytes.NewReader(make([]byte, 10)) }, wantCode: http.StatusOK},
+		"oversized":    {maxBodySize: 10, body: func() io.Reader { return bytes.NewReader(make([]byte, 1024)) }, wantCode: http.StatusRequestEntityTooLarge},
+		"unlimited":    {maxBodySize: -1, body: func() io.Reader { return bytes.NewReader(make([]byte, 1024)) }, wantCode: http.StatusOK},
+		"truncated": {
+			body:     func() io.Reader { return &failingReader{data: []byte("123"), err: io.ErrUnexpectedEOF} },
+			wantCode: http.StatusBadRequest,
+		},
+		"read_error": {
+			body:     func() io.Reader { return &failingReader{data: []byte("123"), err: errors.New("connection lost")} },
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for name, tt := range cases {
+		for _, path := range paths {
+			t.Run(name+path, func(t *testing.T) {
+				srv := &Server{MaxBodySize: tt.maxBodySize}
+
+				responseRecorder := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodPost, path, tt.body())
+
+				srv.ServeHTTP(responseRecorder, request)
+
+				if responseRecorder.Code != tt.wantCode {
+					t.Fatalf("expected %d, got `%d`", tt.wantCode, responseRecorder.Code)
+				}
+			})
+		}
+	}
+	t.Run("default_limit", func(t *testing.T) {
+		srv := &Server{}
+
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, DefaultMaxBodySize+1)))
+
+		srv.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got `%d`", responseRecorder.Code)
+		}
+	})
+}
+
+func TestStatsCounter(t *testing.T) {
+	inputs := map[string]string{
+		"ascii":            "hello world\nfoo  bar\n",
+		"multi_byte_runes": "zażółć gęślą\njaźń",
+		"invalid_utf8":     "a\xffb \xe2\x82",
+		"spaces":           " a b\n\n",
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			// Writing byte by byte splits every multi-byte rune between writes.
+			var counter statsCounter
+			for i := range len(input) {
+				counter.Write([]byte{input[i]})
+			}
+
+			want := Stats{
+				Bytes: len(input),
+				Runes: utf8.RuneCountInString(input),
+				Lines: strings.Count(input, "\n"),
+				Words: len(strings.Fields(input)),
+			}
+			if !strings.HasSuffix(input, "\n") {
+				want.Lines++
+			}
+			if got := counter.Stats(); got != want {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+			if got := ContentStats([]byte(input)); got != want {
+				t.Fatalf("expected %+v from ContentStats, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestServer_Routing(t *testing.T) {
+	cases := map[string]struct {
+		method    string
+		path      string
+		wantCode  int
+		wantAllow string
+	}{
+		"size":              {method: http.MethodPost, path: "/", wantCode: http.StatusOK},
+		"size_get":          {method: http.MethodGet, path: "/", wantCode: http.StatusMethodNotAllowed, wantAllow: http.MethodPost},
+		"hash_put":          {method: http.MethodPut, path: "/hash/md5", wantCode: http.StatusMethodNotAllowed, wantAllow: http.MethodPost},
+		"stats_delete":      {method: http.MethodDelete, path: "/stats", wantCode: http.StatusMethodNotAllowed, wantAllow: http.MethodPost},
+		"mime_get":          {method: http.MethodGet, path: "/mime", wantCode: http.StatusMethodNotAllowed, wantAllow: http.MethodPost},
+		"unknown_path":      {method: http.MethodPost, path: "/unknown", wantCode: http.StatusNotFound},
+		"unknown_algorithm": {method: http.MethodPost, path: "/hash/sha1", wantCode: http.StatusNotFound},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte("123")))
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != tt.wantCode {
+				t.Fatalf("expected %d, got `%d`", tt.wantCode, responseRecorder.Code)
+			}
+			if got := responseRecorder.Header().Get("Allow"); got != tt.wantAllow {
+				t.Fatalf("expected Allow `%s`, got `%s`", tt.wantAllow, got)
+			}
+			if tt.wantCode == http.StatusOK {
+				return
+			}
+
+			// Every error is reported as problem details.
+			if got := responseRecorder.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Fatalf("expected application/problem+json, got `%s`", got)
+			}
+			var problem Problem
+			if err := json.NewDecoder(responseRecorder.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != tt.wantCode || problem.Title != http.StatusText(tt.wantCode) || problem.Detail == "" {
+				t.Fatalf("unexpected problem %+v", problem)
+			}
+		})
+	}
+}
+
+func TestServer_Negotiation(t *testing.T) {
+	cases := map[string]struct {
+		path     string
+		accept   string
+		wantType string
+		wantBody string
+	}{
+		"size_text":      {path: "/", wantType: "text/plain; charset=utf-8", wantBody: "3"},
+		"size_json":      {path: "/", accept: "application/json", wantType: "application/json", wantBody: `{"size":3}` + "\n"},
+		"size_json_list": {path: "/", accept: "text/html, application/json;q=0.9", wantType: "application/json", wantBody: `{"size":3}` + "\n"},
+		"size_other":     {path: "/", accept: "text/html", wantType: "text/plain; charset=utf-8", wantBody: "3"},
+		"hash_json":      {path: "/hash/md5", accept: "application/json", wantType: "application/json", wantBody: `{"algorithm":"md5","hash":"202cb962ac59075b964b07152d234b70"}` + "\n"},
+		"mime_json":      {path: "/mime", accept: "application/json", wantType: "application/json", wantBody: `{"mime":"text/plain; charset=utf-8"}` + "\n"},
+		"stats_always":   {path: "/stats", wantType: "application/json", wantBody: `{"bytes":3,"runes":3,"lines":1,"words":1}` + "\n"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader([]byte("123")))
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got `%d`", responseRecorder.Code)
+			}
+			if got := responseRecorder.Header().Get("Content-Type"); got != tt.wantType {
+				t.Fatalf("expected `%s`, got `%s`", tt.wantType, got)
+			}
+			if responseRecorder.Body.String() != tt.wantBody {
+				t.Fatalf("expected `%s`, got `%s`", tt.wantBody, responseRecorder.Body.String())
+			}
+		})
+	}
+}
+
+// encode compresses data with the HTTP content encoding.
+func encode(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "zstd":
+		encoder, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = encoder
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestServer_Encoding(t *testing.T) {
+	payload := bytes.Repeat([]byte("hello world "), 100)
+	gzipped := encode(t, "gzip", payload)
+	deflated := encode(t, "deflate", payload)
+	zstded := encode(t, "zstd", payload)
+	// A frame asking for a 16MB window, more than the 8MB allowed in HTTP: the magic number,
+	// a header with a window descriptor only, and a last raw block of 3 bytes.
+	wide := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x70, 3<<3 | 1, 0x00, 0x00, 'a', 'b', 'c'}
+
+	cases := map[string]struct {
+		encoding       string
+		body           []byte
+		maxBodySize    int64
+		wantCode       int
+		wantBody       string
+		wantCompressed string
+	}{
+		"none":           {body: payload, wantCode: http.StatusOK, wantBody: "1200"},
+		"identity":       {encoding: "identity", body: payload, wantCode: http.StatusOK, wantBody: "1200"},
+		"gzip":           {encoding: "gzip", body: gzipped, wantCode: http.StatusOK, wantBody: "1200", wantCompressed: strconv.Itoa(len(gzipped))},
+		"gzip_case":      {encoding: " GZIP ", body: gzipped, wantCode: http.StatusOK, wantBody: "1200", wantCompressed: strconv.Itoa(len(gzipped))},
+		"deflate":        {encoding: "deflate", body: deflated, wantCode: http.StatusOK, wantBody: "1200", wantCompressed: strconv.Itoa(len(deflated))},
+		"zstd":           {encoding: "zstd", body: zstded, wantCode: http.StatusOK, wantBody: "1200", wantCompressed: strconv.Itoa(len(zstded))},
+		"zstd_malformed": {encoding: "zstd", body: payload, wantCode: http.StatusBadRequest},
+		"zstd_truncated": {encoding: "zstd", body: zstded[:len(zstded)/2], wantCode: http.StatusBadRequest},
+		"zstd_window":    {encoding: "zstd", body: wide, wantCode: http.StatusBadRequest},
+		"zstd_limit":     {encoding: "zstd", body: zstded, maxBodySize: 1000, wantCode: http.StatusRequestEntityTooLarge},
+		"unsupported":    {encoding: "br", body: payload, wantCode: http.StatusUnsupportedMediaType},
+		"stacked":        {encoding: "gzip, deflate", body: gzipped, wantCode: http.StatusUnsupportedMediaType},
+		"malformed":      {encoding: "gzip", body: payload, wantCode: http.StatusBadRequest},
+		"empty":          {encoding: "gzip", wantCode: http.StatusBadRequest},
+		"truncated":      {encoding: "gzip", body: gzipped[:len(gzipped)/2], wantCode: http.StatusBadRequest},
+		"bad_checksum":   {encoding: "deflate", body: append(bytes.Clone(deflated[:len(deflated)-1]), deflated[len(deflated)-1]^0xff), wantCode: http.StatusBadRequest},
+		"decoded_limit":  {encoding: "gzip", body: gzipped, maxBodySize: 1000, wantCode: http.StatusRequestEntityTooLarge},
+		"encoded_limit":  {encoding: "gzip", body: gzipped, maxBodySize: int64(len(gzipped) - 1), wantCode: http.StatusRequestEntityTooLarge},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := &Server{MaxBodySize: tt.maxBodySize}
+
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				request.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != tt.wantCode {
+				t.Fatalf("expected %d, got `%d`: %s", tt.wantCode, responseRecorder.Code, responseRecorder.Body.String())
+			}
+			if tt.wantBody != "" && responseRecorder.Body.String() != tt.wantBody {
+				t.Fatalf("expected `%s`, got `%s`", tt.wantBody, responseRecorder.Body.String())
+			}
+			if got := responseRecorder.Header().Get(CompressedSizeHeader); got != tt.wantCompressed {
+				t.Fatalf("expected compressed size `%s`, got `%s`", tt.wantCompressed, got)
+			}
+			if tt.wantCode == http.StatusUnsupportedMediaType {
+				if got := responseRecorder.Header().Get("Accept-Encoding"); got != "deflate, gzip, zstd" {
+					t.Fatalf("expected Accept-Encoding `deflate, gzip, zstd`, got `%s`", got)
+				}
+			}
+		})
+	}
+	t.Run("other_endpoints", func(t *testing.T) {
+		// Every endpoint analyses the decoded body.
+		srv := &Server{}
+		for path, want := range map[string]string{
+			"/hash/md5": "202cb962ac59075b964b07152d234b70",
+			"/mime":     "text/plain; charset=utf-8",
+		} {
+			responseRecorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encode(t, "gzip", []byte("123"))))
+			request.Header.Set("Content-Encoding", "gzip")
+
+			srv.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Body.String() != want {
+				t.Errorf("%s: expected `%s`, got `%s`", path, want, responseRecorder.Body.String())
+			}
+		}
+	})
+}
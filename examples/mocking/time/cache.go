@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/jonboulle/clockwork"
@@ -12,36 +14,346 @@ import (
 	(see synctest example).
 */
 
-type ID string
+const (
+	// DefaultTTL makes SetWithTTL use the TTL the cache was created with.
+	DefaultTTL time.Duration = 0
+	// NoExpiration marks an entry (or the whole cache when used as its TTL) as never expiring.
+	NoExpiration time.Duration = -1
+)
 
-type Entry struct {
+type Entry[V any] struct {
 	CreatedAt time.Time
-	Value     string
+	// ExpiresAt is the zero time for entries which never expire.
+	ExpiresAt time.Time
+	Value     V
+
+	// err is set for negatively cached loader failures, see WithNegativeTTL.
+	err error
+}
+
+// Expired reports whether the entry is expired at the given time.
+func (e Entry[V]) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && e.ExpiresAt.Before(now)
+}
+
+// Cache is a TTL cache safe for concurrent use by multiple goroutines.
+// It must be created with NewCache.
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]Entry[V]
+
+	// capacity bounds the number of entries, evictor is nil when the cache is unbounded.
+	capacity int
+	evictor  evictor[K]
+
+	// janitorInterval enables the background sweeper when positive.
+	janitorInterval time.Duration
+	stop            chan struct{}
+	wg              sync.WaitGroup
+	closeOnce       sync.Once
+
+	// loads holds the in-flight GetOrLoad calls, so concurrent callers share a single load.
+	loads       map[K]*load[V]
+	negativeTTL time.Duration
+
+	// softTTL and refresh enable stale-while-revalidate when refresh is set.
+	softTTL time.Duration
+	refresh Loader[K, V]
+
+	stats    Stats
+	onEvict  Hook[K, V]
+	onExpire Hook[K, V]
+	// removed holds entries removed under the lock whose hooks have not run yet.
+	removed []removal[K, V]
+
+	// TTL and Clock must not be modified after the cache is in use.
+	TTL   time.Duration
+	Clock clockwork.Clock // Adding controllable clock
+}
+
+// NewCache returns an empty cache whose entries expire after ttl, or never when ttl is NoExpiration.
+// A nil clock defaults to the real wall clock.
+// If the cache is created WithJanitor, Close must be called to stop the background sweeper.
+func NewCache[K comparable, V any](ttl time.Duration, clock clockwork.Clock, opts ...Option[K, V]) *Cache[K, V] {
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+	c := &Cache[K, V]{
+		entries: make(map[K]Entry[V]),
+		loads:   make(map[K]*load[V]),
+		TTL:     ttl,
+		Clock:   clock,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.janitorInterval > 0 {
+		c.stop = make(chan struct{})
+		c.wg.Go(c.janitor)
+	}
+	return c
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	// Get may delete an expired entry, so it needs the write lock as well.
+	c.mu.Lock()
+	defer c.unlock()
+
+	entry, ok := c.lookup(key)
+	if !ok || entry.err != nil {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.stats.Hits++
+	return entry.Value, true
+}
+
+// Set stores value under key using the default TTL of the cache.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, DefaultTTL)
+}
+
+// SetWithTTL stores value under key, overriding the default TTL of the cache for this entry.
+// Use DefaultTTL to keep the default and NoExpiration for an entry which never expires.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.store(key, c.newEntry(value, ttl))
+}
+
+// Delete removes the entry stored under key and reports whether a live value was present.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	ok := c.live(key)
+	c.remove(key, ReasonDeleted)
+	return ok
+}
+
+// GetOrLoad returns the value stored under key. On a miss or an expired entry it calls loader
+// and stores its result. Concurrent callers for the same key wait for a single in-flight load.
+//
+// The load is not cancelled when ctx is done, as other callers may still be waiting for it,
+// but GetOrLoad itself returns ctx.Err() as soon as ctx is done.
+// Loader errors are returned to all waiting callers and are only cached WithNegativeTTL.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	c.mu.Lock()
+	if entry, ok := c.lookup(key); ok {
+		// A negatively cached error holds no value, so it is a miss as in Get.
+		if entry.err != nil {
+			c.stats.Misses++
+		} else {
+			c.stats.Hits++
+		}
+		c.unlock()
+		return entry.Value, entry.err
+	}
+	l, ok := c.loads[key]
+	if !ok {
+		l = &load[V]{done: make(chan struct{})}
+		c.loads[key] = l
+		go c.load(context.WithoutCancel(ctx), key, loader, l)
+	}
+	c.stats.Misses++
+	c.unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// load calls loader, stores its result and wakes up all callers waiting on l.
+func (c *Cache[K, V]) load(ctx context.Context, key K, loader Loader[K, V], l *load[V]) {
+	value, err := loader(ctx, key)
+
+	c.mu.Lock()
+	delete(c.loads, key)
+	switch {
+	case err == nil:
+		c.store(key, c.newEntry(value, DefaultTTL))
+	case c.negativeTTL > 0 && !c.live(key):
+		// A failed load (e.g. a background refresh) never replaces a value which is still live.
+		entry := c.newEntry(value, c.negativeTTL)
+		entry.err = err
+		c.store(key, entry)
+	}
+	c.unlock()
+
+	l.value, l.err = value, err
+	close(l.done)
 }
 
-type Cache struct {
-	entries map[ID]Entry
-	TTL     time.Duration
-	Clock   clockwork.Clock // Adding controllable clock
+// lookup returns a live entry, removing it if it is expired. The caller must hold the lock.
+func (c *Cache[K, V]) lookup(key K) (Entry[V], bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return Entry[V]{}, false
+	}
+	if entry.Expired(c.Clock.Now()) {
+		c.remove(key, ReasonExpired)
+		return Entry[V]{}, false
+	}
+	if c.evictor != nil {
+		c.evictor.access(key)
+	}
+	c.revalidate(key, entry)
+	return entry, true
 }
 
-func (c *Cache) Get(id ID) (string, bool) {
-	entry, ok := c.entries[id]
-	if entry.CreatedAt.Add(c.TTL).Before(c.Clock.Now()) {
-		delete(c.entries, id)
-		return "", false
+// revalidate starts a background refresh of a live entry older than the soft TTL, unless a load
+// of the key is already in flight. The caller must hold the lock.
+func (c *Cache[K, V]) revalidate(key K, entry Entry[V]) {
+	if c.refresh == nil || entry.err != nil {
+		return
+	}
+	if !entry.CreatedAt.Add(c.softTTL).Before(c.Clock.Now()) {
+		return
+	}
+	if _, ok := c.loads[key]; ok {
+		return
 	}
+	l := &load[V]{done: make(chan struct{})}
+	c.loads[key] = l
+	go c.load(context.Background(), key, c.refresh, l)
+}
+
+// live reports whether key holds a live value. The caller must hold the lock.
+func (c *Cache[K, V]) live(key K) bool {
+	entry, ok := c.entries[key]
+	return ok && entry.err == nil && !entry.Expired(c.Clock.Now())
+}
+
+// store inserts or replaces an entry, evicting another one if the cache is full.
+// The caller must hold the lock.
+func (c *Cache[K, V]) store(key K, entry Entry[V]) {
+	if c.evictor != nil {
+		if _, ok := c.entries[key]; ok {
+			c.evictor.access(key)
+		} else {
+			if len(c.entries) >= c.capacity {
+				if victim, ok := c.evictor.victim(); ok {
+					c.remove(victim, ReasonCapacity)
+				}
+			}
+			c.evictor.add(key)
+		}
+	}
+
+	c.entries[key] = entry
+}
+
+// DeleteExpired removes all expired entries from the cache.
+func (c *Cache[K, V]) DeleteExpired() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := c.Clock.Now()
+	for key, entry := range c.entries {
+		if entry.Expired(now) {
+			c.remove(key, ReasonExpired)
+		}
+	}
+}
 
-	return entry.Value, ok
+// Close stops the background sweeper and waits for it to exit.
+// It is safe to call Close multiple times and on a cache without a janitor.
+func (c *Cache[K, V]) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+		}
+	})
+	c.wg.Wait()
+	return nil
 }
 
-func (c *Cache) Set(id ID, value string) {
-	if c.entries == nil {
-		c.entries = make(map[ID]Entry)
+// janitor periodically removes expired entries until the cache is closed.
+// The ticker comes from the cache Clock, so advancing a fake clock triggers sweeps.
+func (c *Cache[K, V]) janitor() {
+	ticker := c.Clock.NewTicker(c.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.Chan():
+			c.DeleteExpired()
+		}
 	}
+}
 
-	c.entries[id] = Entry{
+// newEntry creates an entry expiring after ttl, resolving DefaultTTL to the cache TTL.
+func (c *Cache[K, V]) newEntry(value V, ttl time.Duration) Entry[V] {
+	if ttl == DefaultTTL {
+		ttl = c.TTL
+	}
+	entry := Entry[V]{
 		CreatedAt: c.Clock.Now(),
 		Value:     value,
 	}
+	if ttl != NoExpiration {
+		entry.ExpiresAt = entry.CreatedAt.Add(ttl)
+	}
+	return entry
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = len(c.entries)
+	return stats
+}
+
+// remove deletes an entry and queues the hooks for it. The caller must hold the lock.
+func (c *Cache[K, V]) remove(key K, reason Reason) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	if c.evictor != nil {
+		c.evictor.remove(key)
+	}
+	// Negatively cached errors hold no value, so they are not reported.
+	if entry.err != nil {
+		return
+	}
+
+	switch reason {
+	case ReasonExpired:
+		c.stats.Expirations++
+	case ReasonCapacity:
+		c.stats.Evictions++
+	}
+	if c.onEvict != nil || c.onExpire != nil {
+		c.removed = append(c.removed, removal[K, V]{key: key, value: entry.Value, reason: reason})
+	}
+}
+
+// unlock releases the lock and then runs the hooks for entries removed while it was held,
+// so hooks are free to call back into the cache.
+func (c *Cache[K, V]) unlock() {
+	removed := c.removed
+	c.removed = nil
+	c.mu.Unlock()
+
+	for _, r := range removed {
+		if c.onExpire != nil && r.reason == ReasonExpired {
+			c.onExpire(r.key, r.value, r.reason)
+		}
+		if c.onEvict != nil {
+			c.onEvict(r.key, r.value, r.reason)
+		}
+	}
 }
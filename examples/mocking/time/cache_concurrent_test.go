@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// Those tests are meant to be run with the race detector:
+// go test -count=1 -race .
+// Try removing the locking from Get and Set and run them again.
+
+func TestCache_Concurrent(t *testing.T) {
+	t.Run("fake_clock", func(t *testing.T) {
+		const workers = 8
+		clock := clockwork.NewFakeClock()
+		ch := NewCache[string, string](time.Minute, clock)
+
+		wg := sync.WaitGroup{}
+		for i := range workers {
+			wg.Go(func() {
+				id := fmt.Sprintf("key-%d", i%2)
+				for range 100 {
+					ch.Set(id, "value")
+					ch.Get(id)
+				}
+			})
+		}
+		// Advancing the clock concurrently makes Get delete expired entries while other goroutines Set them.
+		wg.Go(func() {
+			for range 100 {
+				clock.Advance(30 * time.Second)
+			}
+		})
+		wg.Wait()
+
+		ch.Set("key-0", "value")
+		if _, ok := ch.Get("key-0"); !ok {
+			t.Error("key not found in cache")
+		}
+	})
+	t.Run("synctest", func(t *testing.T) {
+		// Inside the bubble the real clock is backed by the fake synctest time,
+		// so the cache does not need a fake clock at all.
+		synctest.Test(t, func(t *testing.T) {
+			ch := NewCache[string, string](time.Minute, clockwork.NewRealClock())
+			ch.Set("key", "value")
+
+			for range 4 {
+				go func() {
+					ch.Get("key")
+				}()
+				go func() {
+					ch.Set("other", "value")
+				}()
+			}
+			synctest.Wait()
+
+			if _, ok := ch.Get("key"); !ok {
+				t.Error("key not found in cache")
+			}
+
+			time.Sleep(2 * time.Minute)
+			for _, id := range []string{"key", "other"} {
+				go func() {
+					if _, ok := ch.Get(id); ok {
+						t.Errorf("expected %s to expire", id)
+					}
+				}()
+			}
+			synctest.Wait()
+
+			if got := len(ch.entries); got != 0 {
+				t.Errorf("got %d entries, want 0", got)
+			}
+		})
+	})
+}
@@ -9,10 +9,7 @@ import (
 
 func TestCache(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
-		ch := Cache{
-			TTL:   time.Hour,
-			Clock: clockwork.NewFakeClock(),
-		}
+		ch := NewCache[string, string](time.Hour, clockwork.NewFakeClock())
 		expected := "value"
 
 		ch.Set("key", expected)
@@ -26,10 +23,7 @@ func TestCache(t *testing.T) {
 	})
 	t.Run("expired", func(t *testing.T) {
 		clock := clockwork.NewFakeClock()
-		ch := Cache{
-			TTL:   time.Hour,
-			Clock: clock,
-		}
+		ch := NewCache[string, string](time.Hour, clock)
 		expected := "value"
 
 		ch.Set("key", expected)
@@ -40,4 +34,92 @@ func TestCache(t *testing.T) {
 			t.Error("expected key to expire")
 		}
 	})
+	t.Run("missing", func(t *testing.T) {
+		ch := NewCache[string, string](time.Hour, clockwork.NewFakeClock())
+
+		_, ok := ch.Get("key")
+		if ok {
+			t.Error("expected key to be missing")
+		}
+	})
+}
+
+func TestCache_SetWithTTL(t *testing.T) {
+	cases := map[string]struct {
+		cacheTTL time.Duration
+		entryTTL time.Duration
+		advance  time.Duration
+		wantOk   bool
+	}{
+		"default_alive":          {cacheTTL: time.Hour, entryTTL: DefaultTTL, advance: 30 * time.Minute, wantOk: true},
+		"default_expired":        {cacheTTL: time.Hour, entryTTL: DefaultTTL, advance: 2 * time.Hour, wantOk: false},
+		"shorter_expired":        {cacheTTL: time.Hour, entryTTL: time.Minute, advance: 2 * time.Minute, wantOk: false},
+		"longer_alive":           {cacheTTL: time.Minute, entryTTL: time.Hour, advance: 30 * time.Minute, wantOk: true},
+		"no_expiration":          {cacheTTL: time.Minute, entryTTL: NoExpiration, advance: 24 * time.Hour, wantOk: true},
+		"cache_no_expiration":    {cacheTTL: NoExpiration, entryTTL: DefaultTTL, advance: 24 * time.Hour, wantOk: true},
+		"override_no_expiration": {cacheTTL: NoExpiration, entryTTL: time.Minute, advance: 2 * time.Minute, wantOk: false},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			ch := NewCache[string, int](tt.cacheTTL, clock)
+
+			ch.SetWithTTL("key", 42, tt.entryTTL)
+			clock.Advance(tt.advance)
+
+			got, ok := ch.Get("key")
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %t, want %t", ok, tt.wantOk)
+			}
+			if ok && got != 42 {
+				t.Errorf("got %d, want %d", got, 42)
+			}
+		})
+	}
+}
+
+func TestEntry_Expired(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := Entry[string]{CreatedAt: now, ExpiresAt: now.Add(time.Minute)}
+	if entry.Expired(now.Add(time.Minute)) {
+		t.Error("expected entry to be alive at its expiry time")
+	}
+	if !entry.Expired(now.Add(time.Minute + time.Nanosecond)) {
+		t.Error("expected entry to be expired after its expiry time")
+	}
+
+	forever := Entry[string]{CreatedAt: now}
+	if forever.Expired(now.Add(100 * 365 * 24 * time.Hour)) {
+		t.Error("expected entry without expiry to never expire")
+	}
+}
+
+func TestCache_Delete(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var reasons []Reason
+	ch := NewCache(time.Minute, clock, WithOnEvict(func(key string, value string, reason Reason) {
+		reasons = append(reasons, reason)
+	}))
+
+	ch.Set("key", "value")
+	if !ch.Delete("key") {
+		t.Error("expected key to be deleted")
+	}
+	if _, ok := ch.Get("key"); ok {
+		t.Error("expected key to be missing after delete")
+	}
+	if ch.Delete("key") {
+		t.Error("expected second delete to report a missing key")
+	}
+
+	ch.Set("expired", "value")
+	clock.Advance(2 * time.Minute)
+	if ch.Delete("expired") {
+		t.Error("expected delete of an expired key to report a missing key")
+	}
+
+	if len(reasons) != 2 || reasons[0] != ReasonDeleted || reasons[1] != ReasonDeleted {
+		t.Errorf("got OnEvict reasons %v, want [deleted deleted]", reasons)
+	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	cache "mocking_time"
+	"mocking_time/internal/server"
+)
+
+func main() {
+	var (
+		addr     = flag.String("addr", ":8081", "listen address")
+		ttl      = flag.Duration("ttl", 5*time.Minute, "default TTL of stored values")
+		capacity = flag.Int("capacity", 0, "maximum number of stored values, 0 means unbounded")
+		janitor  = flag.Duration("janitor", time.Minute, "interval of expired values cleanup, 0 disables it")
+	)
+	flag.Parse()
+
+	c := cache.NewCache(*ttl, nil,
+		cache.WithCapacity[string, []byte](*capacity, cache.LRU),
+		cache.WithJanitor[string, []byte](*janitor),
+	)
+	defer c.Close()
+
+	srv := http.Server{
+		Addr:    *addr,
+		Handler: server.NewServer(c),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Running server in a separate routine
+	go func() {
+		slog.Info("cache server listening", slog.String("addr", *addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server closed with err", slog.String("error", err.Error()))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Bounding shutdown, so a stuck connection cannot block the process forever.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown with err", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Policy selects which entry is evicted once a capacity-bounded cache is full.
+type Policy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU Policy = iota
+	// LFU evicts the least frequently used entry. Ties are broken by evicting the least recently used one.
+	LFU
+	// FIFO evicts the oldest inserted entry regardless of how often it is read.
+	FIFO
+)
+
+func (p Policy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	case FIFO:
+		return "FIFO"
+	default:
+		return "Policy(unknown)"
+	}
+}
+
+// evictor keeps track of the eviction order of entries.
+// It is not safe for concurrent use, the cache calls it with its lock held.
+type evictor[K comparable] interface {
+	// add registers a new entry.
+	add(key K)
+	// access records a read or an overwrite of an existing entry.
+	access(key K)
+	// remove forgets an entry that left the cache.
+	remove(key K)
+	// victim returns the entry that should be evicted next.
+	victim() (K, bool)
+}
+
+func newEvictor[K comparable](policy Policy) evictor[K] {
+	switch policy {
+	case LFU:
+		return &lfuEvictor[K]{items: make(map[K]*lfuItem[K])}
+	case FIFO:
+		return &listEvictor[K]{elements: make(map[K]*list.Element)}
+	default:
+		return &listEvictor[K]{elements: make(map[K]*list.Element), moveOnAccess: true}
+	}
+}
+
+// listEvictor implements LRU and FIFO. The front of the list is evicted first.
+type listEvictor[K comparable] struct {
+	order        list.List
+	elements     map[K]*list.Element
+	moveOnAccess bool
+}
+
+func (e *listEvictor[K]) add(key K) {
+	e.elements[key] = e.order.PushBack(key)
+}
+
+func (e *listEvictor[K]) access(key K) {
+	if el, ok := e.elements[key]; ok && e.moveOnAccess {
+		e.order.MoveToBack(el)
+	}
+}
+
+func (e *listEvictor[K]) remove(key K) {
+	if el, ok := e.elements[key]; ok {
+		e.order.Remove(el)
+		delete(e.elements, key)
+	}
+}
+
+func (e *listEvictor[K]) victim() (K, bool) {
+	front := e.order.Front()
+	if front == nil {
+		var zero K
+		return zero, false
+	}
+	return front.Value.(K), true
+}
+
+type lfuItem[K comparable] struct {
+	key   K
+	count int
+	// tick of the last access, used to break ties between equally used entries.
+	tick  uint64
+	index int
+}
+
+// lfuEvictor implements LFU using a min-heap ordered by access count and last access.
+type lfuEvictor[K comparable] struct {
+	heap  lfuHeap[K]
+	items map[K]*lfuItem[K]
+	tick  uint64
+}
+
+func (e *lfuEvictor[K]) add(key K) {
+	e.tick++
+	item := &lfuItem[K]{key: key, count: 1, tick: e.tick}
+	e.items[key] = item
+	heap.Push(&e.heap, item)
+}
+
+func (e *lfuEvictor[K]) access(key K) {
+	item, ok := e.items[key]
+	if !ok {
+		return
+	}
+	e.tick++
+	item.count++
+	item.tick = e.tick
+	heap.Fix(&e.heap, item.index)
+}
+
+func (e *lfuEvictor[K]) remove(key K) {
+	item, ok := e.items[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&e.heap, item.index)
+	delete(e.items, key)
+}
+
+func (e *lfuEvictor[K]) victim() (K, bool) {
+	if len(e.heap) == 0 {
+		var zero K
+		return zero, false
+	}
+	return e.heap[0].key, true
+}
+
+// lfuHeap implements heap.Interface.
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
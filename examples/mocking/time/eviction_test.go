@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestCache_Capacity(t *testing.T) {
+	cases := map[string]struct {
+		policy Policy
+		// reads are performed on the full cache before inserting "d"
+		reads   []string
+		evicted string
+	}{
+		"lru":              {policy: LRU, reads: []string{"a", "b"}, evicted: "c"},
+		"lru_no_reads":     {policy: LRU, evicted: "a"},
+		"lfu":              {policy: LFU, reads: []string{"a", "a", "c", "b", "b"}, evicted: "c"},
+		"lfu_tie_lru":      {policy: LFU, reads: []string{"c", "b", "a"}, evicted: "c"},
+		"fifo":             {policy: FIFO, reads: []string{"a", "a", "b"}, evicted: "a"},
+		"fifo_no_reads":    {policy: FIFO, evicted: "a"},
+		"lru_recent_reads": {policy: LRU, reads: []string{"b", "c"}, evicted: "a"},
+		"lfu_single_reads": {policy: LFU, reads: []string{"a", "b", "c", "a"}, evicted: "b"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			ch := NewCache[string, string](time.Hour, clock, WithCapacity[string, string](3, tt.policy))
+
+			for _, id := range []string{"a", "b", "c"} {
+				ch.Set(id, id)
+				clock.Advance(time.Second)
+			}
+			for _, id := range tt.reads {
+				if _, ok := ch.Get(id); !ok {
+					t.Fatalf("key %s not found in cache", id)
+				}
+				clock.Advance(time.Second)
+			}
+			ch.Set("d", "d")
+
+			if got := len(ch.entries); got != 3 {
+				t.Errorf("got %d entries, want 3", got)
+			}
+			for _, id := range []string{"a", "b", "c", "d"} {
+				_, ok := ch.Get(id)
+				if id == tt.evicted && ok {
+					t.Errorf("expected %s to be evicted", id)
+				}
+				if id != tt.evicted && !ok {
+					t.Errorf("expected %s to be present", id)
+				}
+			}
+		})
+	}
+}
+
+func TestCache_CapacityExpired(t *testing.T) {
+	t.Run("expired_entry_frees_slot", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		ch := NewCache[string, string](time.Minute, clock, WithCapacity[string, string](2, LRU))
+
+		ch.Set("a", "a")
+		clock.Advance(30 * time.Second)
+		ch.Set("b", "b")
+		clock.Advance(45 * time.Second)
+
+		// "a" expired and is removed on read, so inserting "c" must not evict "b".
+		if _, ok := ch.Get("a"); ok {
+			t.Fatal("expected a to expire")
+		}
+		ch.Set("c", "c")
+
+		for _, id := range []string{"b", "c"} {
+			if _, ok := ch.Get(id); !ok {
+				t.Errorf("expected %s to be present", id)
+			}
+		}
+	})
+	t.Run("overwrite_does_not_evict", func(t *testing.T) {
+		ch := NewCache[string, string](time.Minute, clockwork.NewFakeClock(), WithCapacity[string, string](2, FIFO))
+
+		ch.Set("a", "a")
+		ch.Set("b", "b")
+		ch.Set("a", "updated")
+
+		got, ok := ch.Get("a")
+		if !ok || got != "updated" {
+			t.Errorf("got %s, want %s", got, "updated")
+		}
+		if _, ok := ch.Get("b"); !ok {
+			t.Error("expected b to be present")
+		}
+	})
+	t.Run("unbounded", func(t *testing.T) {
+		ch := NewCache[string, string](time.Minute, clockwork.NewFakeClock(), WithCapacity[string, string](0, LRU))
+
+		for _, id := range []string{"a", "b", "c"} {
+			ch.Set(id, id)
+		}
+		if got := len(ch.entries); got != 3 {
+			t.Errorf("got %d entries, want 3", got)
+		}
+	})
+}
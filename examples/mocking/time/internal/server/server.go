@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	cache "mocking_time"
+)
+
+const (
+	// TTLHeader optionally overrides the cache TTL of a PUT value. It holds a Go duration (e.g. `30s`)
+	// or `never` for a value which does not expire.
+	TTLHeader = "X-TTL"
+
+	// maxValueSize limits the size of a single stored value.
+	maxValueSize = 1 << 20
+)
+
+// Server exposes a cache as a small key-value HTTP service:
+//
+//	GET    /keys/{id}  returns the stored value
+//	PUT    /keys/{id}  stores the request body
+//	DELETE /keys/{id}  removes the value
+//	GET    /stats      returns the cache statistics as JSON
+type Server struct {
+	cache *cache.Cache[string, []byte]
+	mux   *http.ServeMux
+}
+
+func NewServer(c *cache.Cache[string, []byte]) *Server {
+	s := &Server{
+		cache: c,
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /keys/{id}", s.get)
+	s.mux.HandleFunc("PUT /keys/{id}", s.put)
+	s.mux.HandleFunc("DELETE /keys/{id}", s.delete)
+	s.mux.HandleFunc("GET /stats", s.stats)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.cache.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(value)
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request) {
+	ttl, err := parseTTL(r.Header.Get(TTLHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "reading body", http.StatusBadRequest)
+		return
+	}
+
+	s.cache.SetWithTTL(r.PathValue("id"), value, ttl)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	if !s.cache.Delete(r.PathValue("id")) {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type statsResponse struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Expirations uint64 `json:"expirations"`
+	Evictions   uint64 `json:"evictions"`
+	Size        int    `json:"size"`
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	stats := s.cache.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statsResponse(stats))
+}
+
+// parseTTL parses the TTLHeader value. An empty value keeps the default TTL of the cache.
+func parseTTL(value string) (time.Duration, error) {
+	switch value {
+	case "":
+		return cache.DefaultTTL, nil
+	case "never":
+		return cache.NoExpiration, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, errors.New("invalid " + TTLHeader + " header: expected a positive duration or `never`")
+	}
+	return ttl, nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	cache "mocking_time"
+)
+
+func setupServer() (*Server, *clockwork.FakeClock) {
+	clock := clockwork.NewFakeClock()
+	return NewServer(cache.NewCache[string, []byte](time.Hour, clock)), clock
+}
+
+func doRequest(srv *Server, method, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	srv.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+func TestServer_Keys(t *testing.T) {
+	t.Run("put_get", func(t *testing.T) {
+		srv, _ := setupServer()
+
+		resp := doRequest(srv, http.MethodPut, "/keys/abc", []byte("value"), nil)
+		if resp.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got `%d`", resp.Code)
+		}
+
+		resp = doRequest(srv, http.MethodGet, "/keys/abc", nil, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got `%d`", resp.Code)
+		}
+		if resp.Body.String() != "value" {
+			t.Fatalf("expected `value`, got `%s`", resp.Body.String())
+		}
+	})
+	t.Run("get_missing", func(t *testing.T) {
+		srv, _ := setupServer()
+
+		resp := doRequest(srv, http.MethodGet, "/keys/abc", nil, nil)
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got `%d`", resp.Code)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		srv, _ := setupServer()
+		doRequest(srv, http.MethodPut, "/keys/abc", []byte("value"), nil)
+
+		resp := doRequest(srv, http.MethodDelete, "/keys/abc", nil, nil)
+		if resp.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got `%d`", resp.Code)
+		}
+		resp = doRequest(srv, http.MethodDelete, "/keys/abc", nil, nil)
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got `%d`", resp.Code)
+		}
+	})
+	t.Run("method_not_allowed", func(t *testing.T) {
+		srv, _ := setupServer()
+
+		resp := doRequest(srv, http.MethodPost, "/keys/abc", []byte("value"), nil)
+		if resp.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405, got `%d`", resp.Code)
+		}
+	})
+	t.Run("too_large", func(t *testing.T) {
+		srv, _ := setupServer()
+
+		resp := doRequest(srv, http.MethodPut, "/keys/abc", make([]byte, maxValueSize+1), nil)
+		if resp.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got `%d`", resp.Code)
+		}
+	})
+}
+
+func TestServer_TTL(t *testing.T) {
+	cases := map[string]struct {
+		ttl      string
+		advance  time.Duration
+		wantCode int
+	}{
+		"default_alive":   {ttl: "", advance: 30 * time.Minute, wantCode: http.StatusOK},
+		"default_expired": {ttl: "", advance: 2 * time.Hour, wantCode: http.StatusNotFound},
+		"custom_expired":  {ttl: "1m", advance: 2 * time.Minute, wantCode: http.StatusNotFound},
+		"custom_alive":    {ttl: "3h", advance: 2 * time.Hour, wantCode: http.StatusOK},
+		"never":           {ttl: "never", advance: 24 * time.Hour, wantCode: http.StatusOK},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, clock := setupServer()
+
+			header := http.Header{}
+			if tt.ttl != "" {
+				header.Set(TTLHeader, tt.ttl)
+			}
+			resp := doRequest(srv, http.MethodPut, "/keys/abc", []byte("value"), header)
+			if resp.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got `%d`", resp.Code)
+			}
+			clock.Advance(tt.advance)
+
+			resp = doRequest(srv, http.MethodGet, "/keys/abc", nil, nil)
+			if resp.Code != tt.wantCode {
+				t.Fatalf("expected %d, got `%d`", tt.wantCode, resp.Code)
+			}
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		for _, ttl := range []string{"soon", "-1m", "0s"} {
+			srv, _ := setupServer()
+			header := http.Header{}
+			header.Set(TTLHeader, ttl)
+
+			resp := doRequest(srv, http.MethodPut, "/keys/abc", []byte("value"), header)
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for `%s`, got `%d`", ttl, resp.Code)
+			}
+		}
+	})
+}
+
+func TestServer_Stats(t *testing.T) {
+	srv, _ := setupServer()
+	doRequest(srv, http.MethodPut, "/keys/abc", []byte("value"), nil)
+	doRequest(srv, http.MethodGet, "/keys/abc", nil, nil)
+	doRequest(srv, http.MethodGet, "/keys/missing", nil, nil)
+
+	resp := doRequest(srv, http.MethodGet, "/stats", nil, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got `%d`", resp.Code)
+	}
+	if got := resp.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("expected application/json, got `%s`", got)
+	}
+
+	var got statsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := statsResponse{Hits: 1, Misses: 1, Size: 1}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestCache_Janitor(t *testing.T) {
+	t.Run("fake_clock", func(t *testing.T) {
+		// synctest.Wait lets us wait for the janitor to finish a sweep after advancing the fake clock.
+		// If Close did not stop the janitor, synctest.Test would fail with blocked goroutines remaining.
+		synctest.Test(t, func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			ch := NewCache[string, string](time.Minute, clock, WithJanitor[string, string](10*time.Second))
+			defer ch.Close()
+			// Wait for the janitor to create its ticker before moving the clock.
+			synctest.Wait()
+
+			ch.Set("old", "value")
+			clock.Advance(50 * time.Second)
+			ch.Set("new", "value")
+			synctest.Wait()
+
+			if got := len(ch.entries); got != 2 {
+				t.Fatalf("got %d entries, want 2", got)
+			}
+
+			// Only "old" is expired when the next tick fires.
+			clock.Advance(20 * time.Second)
+			synctest.Wait()
+
+			ch.mu.Lock()
+			_, oldOk := ch.entries["old"]
+			_, newOk := ch.entries["new"]
+			ch.mu.Unlock()
+			if oldOk {
+				t.Error("expected old to be swept")
+			}
+			if !newOk {
+				t.Error("expected new to be present")
+			}
+		})
+	})
+	t.Run("real_clock", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			ch := NewCache[string, string](time.Minute, nil, WithJanitor[string, string](time.Minute))
+			defer ch.Close()
+
+			ch.Set("key", "value")
+			time.Sleep(2*time.Minute + time.Second)
+			synctest.Wait()
+
+			if got := len(ch.entries); got != 0 {
+				t.Errorf("got %d entries, want 0", got)
+			}
+		})
+	})
+	t.Run("close", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			ch := NewCache[string, string](time.Minute, clock, WithJanitor[string, string](time.Second))
+
+			ch.Set("key", "value")
+			if err := ch.Close(); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if err := ch.Close(); err != nil {
+				t.Fatalf("expected no error on second close, got `%s`", err.Error())
+			}
+
+			// Once closed, advancing the clock must not sweep anything.
+			clock.Advance(time.Hour)
+			synctest.Wait()
+			if got := len(ch.entries); got != 1 {
+				t.Errorf("got %d entries, want 1", got)
+			}
+		})
+	})
+	t.Run("without_janitor", func(t *testing.T) {
+		ch := NewCache[string, string](time.Minute, clockwork.NewFakeClock())
+		if err := ch.Close(); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+	})
+}
+
+func TestCache_DeleteExpired(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	ch := NewCache[string, string](time.Minute, clock, WithCapacity[string, string](10, LRU))
+
+	ch.Set("old", "value")
+	clock.Advance(2 * time.Minute)
+	ch.Set("new", "value")
+	ch.DeleteExpired()
+
+	if got := len(ch.entries); got != 1 {
+		t.Errorf("got %d entries, want 1", got)
+	}
+	if _, ok := ch.Get("new"); !ok {
+		t.Error("expected new to be present")
+	}
+}
@@ -0,0 +1,14 @@
+package cache
+
+import "context"
+
+// Loader fetches the value for key from the underlying data source on a cache miss.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// load is a single in-flight call to a Loader shared by all GetOrLoad callers of a key.
+// value and err are written before done is closed and must only be read after that.
+type load[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
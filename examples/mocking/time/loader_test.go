@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// countingLoader returns a loader which takes a second to respond and counts its calls.
+func countingLoader(calls *atomic.Int32, value string, err error) Loader[string, string] {
+	return func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		time.Sleep(time.Second)
+		return value, err
+	}
+}
+
+func TestCache_GetOrLoad(t *testing.T) {
+	t.Run("coalescing", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			const callers = 10
+			var calls atomic.Int32
+			ch := NewCache[string, string](time.Minute, nil)
+			loader := countingLoader(&calls, "value", nil)
+
+			wg := sync.WaitGroup{}
+			for range callers {
+				wg.Go(func() {
+					got, err := ch.GetOrLoad(t.Context(), "key", loader)
+					if err != nil {
+						t.Errorf("expected no error, got `%s`", err.Error())
+					}
+					if got != "value" {
+						t.Errorf("got %s, want %s", got, "value")
+					}
+				})
+			}
+			// All callers are blocked waiting for the single load to finish.
+			synctest.Wait()
+			if got := calls.Load(); got != 1 {
+				t.Errorf("got %d loader calls while loading, want 1", got)
+			}
+			wg.Wait()
+
+			if _, err := ch.GetOrLoad(t.Context(), "key", loader); err != nil {
+				t.Fatalf("expected no error, got `%s`", err.Error())
+			}
+			if got := calls.Load(); got != 1 {
+				t.Errorf("got %d loader calls, want 1", got)
+			}
+		})
+	})
+	t.Run("different_keys", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			ch := NewCache[string, string](time.Minute, nil)
+			loader := countingLoader(&calls, "value", nil)
+
+			for _, key := range []string{"a", "b", "c"} {
+				go ch.GetOrLoad(t.Context(), key, loader)
+			}
+			synctest.Wait()
+
+			if got := calls.Load(); got != 3 {
+				t.Errorf("got %d loader calls, want 3", got)
+			}
+			time.Sleep(time.Second)
+			synctest.Wait()
+		})
+	})
+	t.Run("expired", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			ch := NewCache[string, string](time.Minute, nil)
+			loader := countingLoader(&calls, "value", nil)
+
+			ch.Set("key", "stale")
+			got, _ := ch.GetOrLoad(t.Context(), "key", loader)
+			if got != "stale" || calls.Load() != 0 {
+				t.Fatalf("got %s after %d loader calls, want cached value", got, calls.Load())
+			}
+
+			time.Sleep(2 * time.Minute)
+			got, _ = ch.GetOrLoad(t.Context(), "key", loader)
+			if got != "value" || calls.Load() != 1 {
+				t.Errorf("got %s after %d loader calls, want reloaded value", got, calls.Load())
+			}
+		})
+	})
+	t.Run("error_not_cached", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			expectedErr := errors.New("backend down")
+			ch := NewCache[string, string](time.Minute, nil)
+			loader := countingLoader(&calls, "", expectedErr)
+
+			for range 2 {
+				if _, err := ch.GetOrLoad(t.Context(), "key", loader); !errors.Is(err, expectedErr) {
+					t.Fatalf("expected %v, got %v", expectedErr, err)
+				}
+			}
+			if got := calls.Load(); got != 2 {
+				t.Errorf("got %d loader calls, want 2", got)
+			}
+			if _, ok := ch.Get("key"); ok {
+				t.Error("expected failed load not to be cached")
+			}
+		})
+	})
+	t.Run("negative_ttl", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			expectedErr := errors.New("backend down")
+			ch := NewCache[string, string](time.Minute, nil, WithNegativeTTL[string, string](10*time.Second))
+			loader := countingLoader(&calls, "", expectedErr)
+
+			for range 2 {
+				if _, err := ch.GetOrLoad(t.Context(), "key", loader); !errors.Is(err, expectedErr) {
+					t.Fatalf("expected %v, got %v", expectedErr, err)
+				}
+			}
+			if got := calls.Load(); got != 1 {
+				t.Errorf("got %d loader calls, want 1", got)
+			}
+			// A cached error is not a value, Get must still report a miss.
+			if _, ok := ch.Get("key"); ok {
+				t.Error("expected negative entry to be a miss for Get")
+			}
+
+			time.Sleep(11 * time.Second)
+			if _, err := ch.GetOrLoad(t.Context(), "key", loader); !errors.Is(err, expectedErr) {
+				t.Fatalf("expected %v, got %v", expectedErr, err)
+			}
+			if got := calls.Load(); got != 2 {
+				t.Errorf("got %d loader calls after negative TTL, want 2", got)
+			}
+		})
+	})
+	t.Run("context_cancelled", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			ch := NewCache[string, string](time.Minute, nil)
+			loader := countingLoader(&calls, "value", nil)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+			defer cancel()
+			if _, err := ch.GetOrLoad(ctx, "key", loader); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+			}
+
+			// The load keeps running for other callers and its result is still cached.
+			synctest.Wait()
+			time.Sleep(time.Second)
+			synctest.Wait()
+			got, ok := ch.Get("key")
+			if !ok || got != "value" {
+				t.Errorf("got %s, want %s", got, "value")
+			}
+		})
+	})
+	t.Run("fake_clock", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		ch := NewCache[string, int](time.Minute, clock)
+		calls := 0
+		loader := func(ctx context.Context, key string) (int, error) {
+			calls++
+			return calls, nil
+		}
+
+		first, _ := ch.GetOrLoad(context.Background(), "key", loader)
+		clock.Advance(30 * time.Second)
+		second, _ := ch.GetOrLoad(context.Background(), "key", loader)
+		clock.Advance(time.Minute)
+		third, _ := ch.GetOrLoad(context.Background(), "key", loader)
+
+		if first != 1 || second != 1 || third != 2 {
+			t.Errorf("got %d, %d, %d, want 1, 1, 2", first, second, third)
+		}
+	})
+}
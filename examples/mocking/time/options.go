@@ -0,0 +1,59 @@
+package cache
+
+import "time"
+
+// Option configures optional Cache behaviour in NewCache.
+type Option[K comparable, V any] func(*Cache[K, V])
+
+// WithCapacity limits the cache to max entries. Once full, setting a new key evicts
+// an existing entry chosen by policy. A max of zero or less means the cache is unbounded.
+func WithCapacity[K comparable, V any](max int, policy Policy) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if max <= 0 {
+			return
+		}
+		c.capacity = max
+		c.evictor = newEvictor[K](policy)
+	}
+}
+
+// WithJanitor starts a background goroutine removing expired entries every interval.
+// The cache must be closed with Close once it is no longer needed.
+func WithJanitor[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.janitorInterval = interval
+	}
+}
+
+// WithNegativeTTL caches loader errors returned through GetOrLoad for ttl,
+// so a failing backend is not called again for every request. Errors are not cached by default.
+func WithNegativeTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithOnEvict registers a hook called for every entry removed from the cache, whatever the reason.
+func WithOnEvict[K comparable, V any](hook Hook[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = hook
+	}
+}
+
+// WithOnExpire registers a hook called only for entries removed because their TTL ran out.
+func WithOnExpire[K comparable, V any](hook Hook[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onExpire = hook
+	}
+}
+
+// WithStaleWhileRevalidate serves entries older than softTTL while refreshing them in the background.
+// The first read of such an entry starts a single asynchronous call to loader, and the stale value
+// is returned until it completes. Entries still disappear once their regular (hard) TTL runs out.
+// A failed refresh keeps the stale value, so the next read after it tries again.
+func WithStaleWhileRevalidate[K comparable, V any](softTTL time.Duration, loader Loader[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.softTTL = softTTL
+		c.refresh = loader
+	}
+}
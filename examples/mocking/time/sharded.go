@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"hash/maphash"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// ShardedCache spreads keys across independently locked Cache shards to reduce lock contention
+// under parallel load. It has the same semantics as Cache for a single key.
+type ShardedCache[K comparable, V any] struct {
+	shards []*Cache[K, V]
+	seed   maphash.Seed
+}
+
+// NewShardedCache returns a cache split into n shards (at least one) sharing the same ttl and clock.
+// A nil clock defaults to the real wall clock. Options are applied to every shard,
+// so WithCapacity limits each shard separately and WithJanitor starts one sweeper per shard.
+func NewShardedCache[K comparable, V any](n int, ttl time.Duration, clock clockwork.Clock, opts ...Option[K, V]) *ShardedCache[K, V] {
+	if n < 1 {
+		n = 1
+	}
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+	c := &ShardedCache[K, V]{
+		shards: make([]*Cache[K, V], n),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i] = NewCache(ttl, clock, opts...)
+	}
+	return c
+}
+
+func (c *ShardedCache[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).Get(key)
+}
+
+// Set stores value under key using the default TTL of the cache.
+func (c *ShardedCache[K, V]) Set(key K, value V) {
+	c.shard(key).Set(key, value)
+}
+
+// SetWithTTL stores value under key, see Cache.SetWithTTL.
+func (c *ShardedCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.shard(key).SetWithTTL(key, value, ttl)
+}
+
+// Delete removes the entry stored under key, see Cache.Delete.
+func (c *ShardedCache[K, V]) Delete(key K) bool {
+	return c.shard(key).Delete(key)
+}
+
+// GetOrLoad returns the value stored under key, loading it on a miss, see Cache.GetOrLoad.
+func (c *ShardedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	return c.shard(key).GetOrLoad(ctx, key, loader)
+}
+
+// DeleteExpired removes all expired entries from every shard.
+func (c *ShardedCache[K, V]) DeleteExpired() {
+	for _, shard := range c.shards {
+		shard.DeleteExpired()
+	}
+}
+
+// Stats returns the sum of the statistics of all shards.
+// Shards are read one after another, so the result is not an atomic snapshot of the whole cache.
+func (c *ShardedCache[K, V]) Stats() Stats {
+	var total Stats
+	for _, shard := range c.shards {
+		stats := shard.Stats()
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Expirations += stats.Expirations
+		total.Evictions += stats.Evictions
+		total.Size += stats.Size
+	}
+	return total
+}
+
+// Close stops the janitors of all shards.
+func (c *ShardedCache[K, V]) Close() error {
+	for _, shard := range c.shards {
+		shard.Close()
+	}
+	return nil
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *Cache[K, V] {
+	return c.shards[maphash.Comparable(c.seed, key)%uint64(len(c.shards))]
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestShardedCache(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ch := NewShardedCache[string, int](4, time.Hour, clockwork.NewFakeClock())
+
+		for i := range 100 {
+			ch.Set(fmt.Sprintf("key-%d", i), i)
+		}
+		for i := range 100 {
+			got, ok := ch.Get(fmt.Sprintf("key-%d", i))
+			if !ok || got != i {
+				t.Errorf("got %d, want %d", got, i)
+			}
+		}
+		if got := ch.Stats(); got.Size != 100 || got.Hits != 100 {
+			t.Errorf("got %+v, want 100 hits and size 100", got)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		ch := NewShardedCache[string, string](4, time.Hour, clock)
+
+		ch.Set("key", "value")
+		ch.SetWithTTL("forever", "value", NoExpiration)
+		clock.Advance(2 * time.Hour)
+
+		if _, ok := ch.Get("key"); ok {
+			t.Error("expected key to expire")
+		}
+		if _, ok := ch.Get("forever"); !ok {
+			t.Error("expected forever to be present")
+		}
+	})
+	t.Run("shards_used", func(t *testing.T) {
+		ch := NewShardedCache[int, int](4, time.Hour, clockwork.NewFakeClock())
+
+		for i := range 100 {
+			ch.Set(i, i)
+		}
+		for i, shard := range ch.shards {
+			if shard.Stats().Size == 0 {
+				t.Errorf("expected shard %d to hold entries", i)
+			}
+		}
+	})
+	t.Run("single_shard", func(t *testing.T) {
+		ch := NewShardedCache[string, string](0, time.Hour, nil)
+
+		if got := len(ch.shards); got != 1 {
+			t.Errorf("got %d shards, want 1", got)
+		}
+	})
+}
+
+// getSetter is implemented by both Cache and ShardedCache.
+type getSetter interface {
+	Get(key string) (string, bool)
+	Set(key string, value string)
+}
+
+// benchmarkParallel runs a read-heavy workload (90% Get, 10% Set) on all GOMAXPROCS goroutines.
+// Try comparing results with: go test -run=^$ -bench=Parallel -cpu=1,4,16 .
+func benchmarkParallel(b *testing.B, ch getSetter) {
+	const keys = 1024
+	ids := make([]string, keys)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("key-%d", i)
+		ch.Set(ids[i], "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		for pb.Next() {
+			id := ids[r.IntN(keys)]
+			if r.IntN(10) == 0 {
+				ch.Set(id, "value")
+			} else {
+				ch.Get(id)
+			}
+		}
+	})
+}
+
+func BenchmarkCache_Parallel(b *testing.B) {
+	benchmarkParallel(b, NewCache[string, string](time.Hour, nil))
+}
+
+func BenchmarkShardedCache_Parallel(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkParallel(b, NewShardedCache[string, string](shards, time.Hour, nil))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// snapshotVersion is the version of the format written by Save.
+// It must be bumped whenever the format changes in an incompatible way.
+const snapshotVersion = 1
+
+var ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+
+type snapshot[K comparable, V any] struct {
+	Version int                   `json:"version"`
+	Entries []snapshotEntry[K, V] `json:"entries"`
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	Key       K         `json:"key"`
+	Value     V         `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is omitted for entries which never expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Save writes all live entries to w as versioned JSON. Keys and values must be JSON serializable.
+// Expired entries and negatively cached errors are skipped.
+func (c *Cache[K, V]) Save(w io.Writer) error {
+	c.mu.Lock()
+	now := c.Clock.Now()
+	snap := snapshot[K, V]{
+		Version: snapshotVersion,
+		Entries: make([]snapshotEntry[K, V], 0, len(c.entries)),
+	}
+	for key, entry := range c.entries {
+		if entry.err != nil || entry.Expired(now) {
+			continue
+		}
+		se := snapshotEntry[K, V]{Key: key, Value: entry.Value, CreatedAt: entry.CreatedAt}
+		if !entry.ExpiresAt.IsZero() {
+			se.ExpiresAt = &entry.ExpiresAt
+		}
+		snap.Entries = append(snap.Entries, se)
+	}
+	c.mu.Unlock()
+
+	// Oldest entries first, so loading a snapshot keeps the insertion order.
+	slices.SortStableFunc(snap.Entries, func(a, b snapshotEntry[K, V]) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Load reads entries written by Save from r and adds them to the cache, keeping their original
+// CreatedAt and expiry times. Entries already expired according to the cache Clock are dropped.
+// Loaded entries replace existing ones with the same key and are subject to the cache capacity.
+func (c *Cache[K, V]) Load(r io.Reader) error {
+	var snap snapshot[K, V]
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, snap.Version)
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := c.Clock.Now()
+	for _, se := range snap.Entries {
+		entry := Entry[V]{CreatedAt: se.CreatedAt, Value: se.Value}
+		if se.ExpiresAt != nil {
+			entry.ExpiresAt = *se.ExpiresAt
+		}
+		if entry.Expired(now) {
+			continue
+		}
+		c.store(se.Key, entry)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestCache_SaveLoad(t *testing.T) {
+	t.Run("round_trip", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		src := NewCache[string, int](time.Hour, clock)
+		src.Set("a", 1)
+		clock.Advance(time.Minute)
+		src.SetWithTTL("b", 2, NoExpiration)
+
+		buf := &bytes.Buffer{}
+		if err := src.Save(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+
+		dst := NewCache[string, int](time.Hour, clock)
+		if err := dst.Load(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		for key, want := range map[string]int{"a": 1, "b": 2} {
+			got, ok := dst.Get(key)
+			if !ok || got != want {
+				t.Errorf("got %d for %s, want %d", got, key, want)
+			}
+			// Times are compared with Equal, as the monotonic clock reading is not serialized.
+			gotEntry, wantEntry := dst.entries[key], src.entries[key]
+			if !gotEntry.CreatedAt.Equal(wantEntry.CreatedAt) || !gotEntry.ExpiresAt.Equal(wantEntry.ExpiresAt) {
+				t.Errorf("got entry %+v for %s, want %+v", gotEntry, key, wantEntry)
+			}
+		}
+	})
+	t.Run("expired_dropped", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		src := NewCache[string, string](time.Hour, clock)
+		src.Set("old", "value")
+		clock.Advance(30 * time.Minute)
+		src.Set("new", "value")
+		src.SetWithTTL("forever", "value", NoExpiration)
+
+		buf := &bytes.Buffer{}
+		if err := src.Save(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+
+		// Simulating a restart taking 45 minutes: "old" expires during the downtime.
+		clock.Advance(45 * time.Minute)
+		dst := NewCache[string, string](time.Hour, clock)
+		if err := dst.Load(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+
+		if _, ok := dst.Get("old"); ok {
+			t.Error("expected old to be dropped")
+		}
+		for _, key := range []string{"new", "forever"} {
+			if _, ok := dst.Get(key); !ok {
+				t.Errorf("expected %s to be present", key)
+			}
+		}
+		// "new" keeps its original creation time, so it still expires 60 minutes after being set.
+		clock.Advance(20 * time.Minute)
+		if _, ok := dst.Get("new"); ok {
+			t.Error("expected new to expire with its original TTL")
+		}
+	})
+	t.Run("capacity", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		src := NewCache[string, string](time.Hour, clock)
+		for _, key := range []string{"a", "b", "c"} {
+			src.Set(key, key)
+			clock.Advance(time.Second)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := src.Save(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+		dst := NewCache(time.Hour, clock, WithCapacity[string, string](2, FIFO))
+		if err := dst.Load(buf); err != nil {
+			t.Fatalf("expected no error, got `%s`", err.Error())
+		}
+
+		// Entries are loaded oldest first, so FIFO evicts the oldest one.
+		if _, ok := dst.Get("a"); ok {
+			t.Error("expected a to be evicted")
+		}
+		if got := dst.Stats().Size; got != 2 {
+			t.Errorf("got size %d, want 2", got)
+		}
+	})
+	t.Run("unsupported_version", func(t *testing.T) {
+		ch := NewCache[string, string](time.Hour, clockwork.NewFakeClock())
+
+		err := ch.Load(strings.NewReader(`{"version":2,"entries":[]}`))
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("expected %v, got %v", ErrUnsupportedVersion, err)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		ch := NewCache[string, string](time.Hour, clockwork.NewFakeClock())
+
+		if err := ch.Load(strings.NewReader("not json")); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package cache
+
+// Reason describes why an entry left the cache.
+type Reason int
+
+const (
+	// ReasonExpired means the entry outlived its TTL. It is reported either on read or by the janitor.
+	ReasonExpired Reason = iota
+	// ReasonCapacity means the entry was evicted to make room in a full cache.
+	ReasonCapacity
+	// ReasonDeleted means the entry was removed with Delete.
+	ReasonDeleted
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Hook is called with an entry removed from the cache. Hooks run after the cache lock is released,
+// on the goroutine which caused the removal.
+type Hook[K comparable, V any] func(key K, value V, reason Reason)
+
+// removal is an entry waiting for its hooks to run.
+type removal[K comparable, V any] struct {
+	key    K
+	value  V
+	reason Reason
+}
+
+// Stats is a snapshot of cache statistics returned by Cache.Stats.
+type Stats struct {
+	// Hits and Misses count lookups done through Get and GetOrLoad.
+	Hits   uint64
+	Misses uint64
+	// Expirations counts entries removed because their TTL ran out.
+	Expirations uint64
+	// Evictions counts entries removed to respect the cache capacity.
+	Evictions uint64
+	// Size is the number of entries in the cache, including expired ones which were not removed yet.
+	Size int
+}
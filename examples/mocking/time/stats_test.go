@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+type hookCall struct {
+	key    string
+	value  string
+	reason Reason
+}
+
+func TestCache_Hooks(t *testing.T) {
+	t.Run("expired_on_read", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		var evicted, expired []hookCall
+		ch := NewCache(time.Minute, clock,
+			WithOnEvict(func(key string, value string, reason Reason) {
+				evicted = append(evicted, hookCall{key, value, reason})
+			}),
+			WithOnExpire(func(key string, value string, reason Reason) {
+				expired = append(expired, hookCall{key, value, reason})
+			}),
+		)
+
+		ch.Set("key", "value")
+		clock.Advance(2 * time.Minute)
+		ch.Get("key")
+
+		want := hookCall{"key", "value", ReasonExpired}
+		if len(expired) != 1 || expired[0] != want {
+			t.Errorf("got OnExpire calls %v, want [%v]", expired, want)
+		}
+		if len(evicted) != 1 || evicted[0] != want {
+			t.Errorf("got OnEvict calls %v, want [%v]", evicted, want)
+		}
+	})
+	t.Run("capacity", func(t *testing.T) {
+		var evicted, expired []hookCall
+		ch := NewCache(time.Minute, clockwork.NewFakeClock(),
+			WithCapacity[string, string](1, FIFO),
+			WithOnEvict(func(key string, value string, reason Reason) {
+				evicted = append(evicted, hookCall{key, value, reason})
+			}),
+			WithOnExpire(func(key string, value string, reason Reason) {
+				expired = append(expired, hookCall{key, value, reason})
+			}),
+		)
+
+		ch.Set("a", "1")
+		ch.Set("b", "2")
+
+		want := hookCall{"a", "1", ReasonCapacity}
+		if len(evicted) != 1 || evicted[0] != want {
+			t.Errorf("got OnEvict calls %v, want [%v]", evicted, want)
+		}
+		if len(expired) != 0 {
+			t.Errorf("got OnExpire calls %v, want none", expired)
+		}
+	})
+	t.Run("janitor", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			var mu sync.Mutex
+			var expired []string
+			ch := NewCache(time.Minute, clock,
+				WithJanitor[string, string](time.Minute),
+				WithOnExpire(func(key string, value string, reason Reason) {
+					mu.Lock()
+					defer mu.Unlock()
+					expired = append(expired, key)
+				}),
+			)
+			defer ch.Close()
+			synctest.Wait()
+
+			ch.Set("key", "value")
+			clock.Advance(2 * time.Minute)
+			synctest.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(expired) != 1 || expired[0] != "key" {
+				t.Errorf("got OnExpire calls %v, want [key]", expired)
+			}
+		})
+	})
+	t.Run("hook_reenters_cache", func(t *testing.T) {
+		// Hooks run without the lock held, so calling the cache from a hook must not deadlock.
+		clock := clockwork.NewFakeClock()
+		var ch *Cache[string, string]
+		ch = NewCache(time.Minute, clock,
+			WithOnExpire(func(key string, value string, reason Reason) {
+				ch.Set(key, value+"-refreshed")
+			}),
+		)
+
+		ch.Set("key", "value")
+		clock.Advance(2 * time.Minute)
+		ch.Get("key")
+
+		got, ok := ch.Get("key")
+		if !ok || got != "value-refreshed" {
+			t.Errorf("got %s, want %s", got, "value-refreshed")
+		}
+	})
+}
+
+func TestCache_Stats(t *testing.T) {
+	t.Run("counters", func(t *testing.T) {
+		clock := clockwork.NewFakeClock()
+		ch := NewCache[string, string](time.Minute, clock,
+			WithCapacity[string, string](2, LRU),
+			WithNegativeTTL[string, string](time.Minute),
+		)
+
+		ch.Set("a", "1")
+		ch.Set("b", "2")
+		ch.Get("a")       // hit
+		ch.Get("missing") // miss
+		ch.Set("c", "3")  // evicts b
+		clock.Advance(2 * time.Minute)
+		ch.Get("a") // expired, miss
+		ch.GetOrLoad(context.Background(), "d", func(ctx context.Context, key string) (string, error) {
+			return "4", nil
+		}) // miss, evicts nothing as a is gone
+		failing := func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("unavailable")
+		}
+		ch.GetOrLoad(context.Background(), "e", failing) // miss, the error is cached and evicts c
+		ch.GetOrLoad(context.Background(), "e", failing) // cached error, still a miss
+		ch.Get("e")                                      // cached error, miss
+
+		want := Stats{Hits: 1, Misses: 6, Expirations: 1, Evictions: 2, Size: 2}
+		if got := ch.Stats(); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		// Run with -race to verify Stats can be read while the cache is in use.
+		synctest.Test(t, func(t *testing.T) {
+			ch := NewCache[string, string](time.Minute, nil)
+			ch.Set("key", "value")
+
+			for range 4 {
+				go ch.Get("key")
+				go ch.Stats()
+			}
+			synctest.Wait()
+
+			if got := ch.Stats(); got.Hits != 4 || got.Size != 1 {
+				t.Errorf("got %+v, want 4 hits and size 1", got)
+			}
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	// newCache returns a cache with a 1 minute soft and a 1 hour hard TTL whose loader
+	// returns "fresh-N", where N is the number of the call.
+	newCache := func(clock clockwork.Clock, calls *atomic.Int32, err error) *Cache[string, string] {
+		loader := func(ctx context.Context, key string) (string, error) {
+			n := calls.Add(1)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("fresh-%d", n), nil
+		}
+		return NewCache(time.Hour, clock, WithStaleWhileRevalidate(time.Minute, loader))
+	}
+
+	t.Run("fresh", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			clock := clockwork.NewFakeClock()
+			ch := newCache(clock, &calls, nil)
+
+			ch.Set("key", "value")
+			clock.Advance(30 * time.Second)
+			got, _ := ch.Get("key")
+			synctest.Wait()
+
+			if got != "value" || calls.Load() != 0 {
+				t.Errorf("got %s after %d refreshes, want value without refresh", got, calls.Load())
+			}
+		})
+	})
+	t.Run("stale", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			clock := clockwork.NewFakeClock()
+			ch := newCache(clock, &calls, nil)
+
+			ch.Set("key", "value")
+			clock.Advance(2 * time.Minute)
+
+			// The stale value is served while the refresh runs in the background.
+			got, ok := ch.Get("key")
+			if !ok || got != "value" {
+				t.Fatalf("got %s, want %s", got, "value")
+			}
+			synctest.Wait()
+
+			got, _ = ch.Get("key")
+			if got != "fresh-1" || calls.Load() != 1 {
+				t.Errorf("got %s after %d refreshes, want fresh-1 after 1", got, calls.Load())
+			}
+
+			// The refreshed entry starts a new soft window.
+			clock.Advance(30 * time.Second)
+			ch.Get("key")
+			synctest.Wait()
+			if got := calls.Load(); got != 1 {
+				t.Errorf("got %d refreshes, want 1", got)
+			}
+		})
+	})
+	t.Run("single_refresh", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			release := make(chan struct{})
+			clock := clockwork.NewFakeClock()
+			loader := func(ctx context.Context, key string) (string, error) {
+				calls.Add(1)
+				<-release
+				return "fresh", nil
+			}
+			ch := NewCache(time.Hour, clock, WithStaleWhileRevalidate(time.Minute, loader))
+
+			ch.Set("key", "value")
+			clock.Advance(2 * time.Minute)
+			for range 5 {
+				if got, _ := ch.Get("key"); got != "value" {
+					t.Errorf("got %s, want %s", got, "value")
+				}
+			}
+			synctest.Wait()
+			if got := calls.Load(); got != 1 {
+				t.Errorf("got %d refreshes, want 1", got)
+			}
+
+			close(release)
+			synctest.Wait()
+			if got, _ := ch.Get("key"); got != "fresh" {
+				t.Errorf("got %s, want %s", got, "fresh")
+			}
+		})
+	})
+	t.Run("hard_expired", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			clock := clockwork.NewFakeClock()
+			ch := newCache(clock, &calls, nil)
+
+			ch.Set("key", "value")
+			clock.Advance(2 * time.Hour)
+
+			if _, ok := ch.Get("key"); ok {
+				t.Error("expected key to expire after the hard TTL")
+			}
+			synctest.Wait()
+			if got := calls.Load(); got != 0 {
+				t.Errorf("got %d refreshes, want 0", got)
+			}
+		})
+	})
+	t.Run("refresh_error", func(t *testing.T) {
+		synctest.Test(t, func(t *testing.T) {
+			var calls atomic.Int32
+			clock := clockwork.NewFakeClock()
+			ch := newCache(clock, &calls, errors.New("backend down"))
+
+			ch.Set("key", "value")
+			clock.Advance(2 * time.Minute)
+
+			for range 2 {
+				ch.Get("key")
+				synctest.Wait()
+			}
+			got, ok := ch.Get("key")
+			if !ok || got != "value" {
+				t.Errorf("got %s, want stale %s", got, "value")
+			}
+			synctest.Wait()
+			// Every read after a failed refresh tries again.
+			if got := calls.Load(); got != 3 {
+				t.Errorf("got %d refreshes, want 3", got)
+			}
+		})
+	})
+}